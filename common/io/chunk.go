@@ -0,0 +1,163 @@
+package io
+
+import (
+	"fmt"
+	"io"
+	"remote-debug/common/utils"
+)
+
+// 分块传输大数据, 每块和 SendData 一样带 4 字节长度前缀, 长度为 0 的块代表结束,
+// 总长度不受长度前缀的限制, 双方都不需要把全部数据放在内存中
+
+// ChunkSize 每块的最大长度
+const ChunkSize = 256 << 10
+
+// ChunkWriter 把写入的数据分块发送, 必须调用 Close 发送结束块
+type ChunkWriter struct {
+	conn   io.Writer
+	buffer []byte
+	total  int64
+}
+
+func NewChunkWriter(conn io.Writer) *ChunkWriter {
+	return &ChunkWriter{conn: conn, buffer: make([]byte, 0, ChunkSize)}
+}
+
+func (w *ChunkWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := copy(w.buffer[len(w.buffer):cap(w.buffer)], p)
+		w.buffer = w.buffer[:len(w.buffer)+n]
+		written += n
+		p = p[n:]
+		if len(w.buffer) == cap(w.buffer) {
+			if err := w.flush(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+func (w *ChunkWriter) flush() error {
+	if len(w.buffer) == 0 {
+		return nil
+	}
+	if err := SendData(w.conn, w.buffer); err != nil {
+		return err
+	}
+	w.total += int64(len(w.buffer))
+	w.buffer = w.buffer[:0]
+	return nil
+}
+
+// Close 发送剩余的数据和结束块, 不会关闭连接
+func (w *ChunkWriter) Close() error {
+	if err := w.flush(); err != nil {
+		return err
+	}
+	_, err := w.conn.Write(utils.I2b32(0))
+	return err
+}
+
+// Total 已经发送的字节数
+func (w *ChunkWriter) Total() int64 {
+	return w.total
+}
+
+// ChunkReader 读取 ChunkWriter 发送的数据, 读到结束块时返回 io.EOF
+type ChunkReader struct {
+	conn io.Reader
+	// 当前块还没读取的长度
+	remaining int64
+	total     int64
+	limit     int64
+	eof       bool
+	// 超过限制后不再返回数据, 只能调用 Discard 丢弃
+	err error
+}
+
+// NewChunkReader limit 为总长度的限制, 超过时返回 *utils.LimitError, 小于等于 0 代表不限制
+func NewChunkReader(conn io.Reader, limit int64) *ChunkReader {
+	return &ChunkReader{conn: conn, limit: limit}
+}
+
+func (r *ChunkReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	if r.eof {
+		return 0, io.EOF
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	for r.remaining == 0 {
+		if err := r.next(); err != nil {
+			return 0, err
+		}
+		if r.eof {
+			return 0, io.EOF
+		}
+	}
+
+	if int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+	n, err := r.conn.Read(p)
+	r.remaining -= int64(n)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// next 读取下一块的长度, 读取内容前先校验长度
+func (r *ChunkReader) next() error {
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(r.conn, buf); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	chunkLen32, err := utils.B2i32(buf)
+	if err != nil {
+		return err
+	}
+	chunkLen := int64(chunkLen32)
+	if chunkLen == 0 {
+		r.eof = true
+		return nil
+	}
+	if chunkLen > ChunkSize {
+		return fmt.Errorf("chunk len error: %d", chunkLen)
+	}
+	r.total += chunkLen
+	r.remaining = chunkLen
+	if r.limit > 0 && r.total > r.limit {
+		r.err = &utils.LimitError{What: "upload size", Size: r.total, Limit: r.limit}
+		return r.err
+	}
+	return nil
+}
+
+// Discard 丢弃剩下的数据直到结束块, 不再检查 limit, 丢弃超过 max 字节时返回 *utils.LimitError,
+// 对方写完才会读取结果, 超过限制时先丢弃数据再返回错误, 对方才不会因为连接断开收不到错误
+func (r *ChunkReader) Discard(max int64) error {
+	r.err = nil
+	r.limit = 0
+	n, err := io.CopyN(io.Discard, r, max+1)
+	if err == io.EOF {
+		return nil
+	}
+	if err == nil && n > max {
+		return &utils.LimitError{What: "discard size", Size: n, Limit: max}
+	}
+	return err
+}
+
+// Total 已经接收的字节数, 包括当前块中还没读取的部分
+func (r *ChunkReader) Total() int64 {
+	return r.total
+}
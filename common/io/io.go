@@ -1,13 +1,20 @@
 package io
 
 import (
+	"bytes"
 	"fmt"
-	"net"
+	"io"
 	"remote-debug/common/utils"
 )
 
-// SendMessage TODO 加密消息
-func SendMessage(conn *net.TCPConn, message interface{}) error {
+// MaxMessageSize ReadMessage 和 ReadData 允许的最大消息长度
+var MaxMessageSize int64 = 64 << 20
+
+// 消息长度可以由对方随意声明, 按照实际收到的数据逐步分配内存
+const readChunkSize = 64 << 10
+
+// SendMessage 加密由调用方传入的 TLS 连接负责
+func SendMessage(conn io.Writer, message interface{}) error {
 	// 解析
 	data, err := ToByte(message)
 	if err != nil {
@@ -19,9 +26,14 @@ func SendMessage(conn *net.TCPConn, message interface{}) error {
 	return SendData(conn, data)
 }
 
-func ReadMessage(conn *net.TCPConn, message interface{}) error {
+func ReadMessage(conn io.Reader, message interface{}) error {
+	return ReadMessageLimit(conn, message, MaxMessageSize)
+}
+
+// ReadMessageLimit 读取长度不超过 limit 的消息
+func ReadMessageLimit(conn io.Reader, message interface{}, limit int64) error {
 	// 读取数据
-	data, err := ReadData(conn)
+	data, err := ReadDataLimit(conn, limit)
 	if err != nil {
 		return err
 	}
@@ -34,7 +46,7 @@ func ReadMessage(conn *net.TCPConn, message interface{}) error {
 	return nil
 }
 
-func SendData(conn *net.TCPConn, data []byte) error {
+func SendData(conn io.Writer, data []byte) error {
 	// 发送消息长度
 	if _, err := conn.Write(utils.I2b32(uint32(len(data)))); err != nil {
 		return err
@@ -46,16 +58,16 @@ func SendData(conn *net.TCPConn, data []byte) error {
 	return nil
 }
 
-func ReadData(conn *net.TCPConn) ([]byte, error) {
+func ReadData(conn io.Reader) ([]byte, error) {
+	return ReadDataLimit(conn, MaxMessageSize)
+}
+
+// ReadDataLimit 读取长度不超过 limit 的数据, 超过时返回 *utils.LimitError, 不会读取消息内容
+func ReadDataLimit(conn io.Reader, limit int64) ([]byte, error) {
 	// 读取前缀
 	buf := make([]byte, 4)
-	readSum := 0
-	for readSum < len(buf) {
-		if readLength, err := conn.Read(buf[readSum:]); err != nil {
-			return nil, err
-		} else {
-			readSum += readLength
-		}
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return nil, err
 	}
 
 	// 获取消息长度
@@ -63,21 +75,26 @@ func ReadData(conn *net.TCPConn) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	messageLen := int(messageLen32)
+	messageLen := int64(messageLen32)
 	if messageLen <= 0 {
 		return nil, fmt.Errorf("message len error: %d", messageLen)
 	}
+	if messageLen > limit {
+		return nil, &utils.LimitError{What: "message size", Size: messageLen, Limit: limit}
+	}
 
 	// 读取消息
-	data := make([]byte, messageLen)
-	readSum = 0
-	for readSum < messageLen {
-		if readLength, err := conn.Read(data[readSum:]); err != nil {
-			return nil, err
-		} else {
-			readSum += readLength
+	capacity := messageLen
+	if capacity > readChunkSize {
+		capacity = readChunkSize
+	}
+	buffer := bytes.NewBuffer(make([]byte, 0, capacity))
+	if _, err := io.CopyN(buffer, conn, messageLen); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
 		}
+		return nil, err
 	}
 
-	return data, nil
+	return buffer.Bytes(), nil
 }
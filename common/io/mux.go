@@ -0,0 +1,400 @@
+package io
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// 在一个连接上复用多个双向的流, 只有一方调用 Open, 另一方调用 Accept,
+// 每帧的头部: 4 字节流 id, 1 字节类型, 4 字节长度 (窗口帧为新增的窗口大小), 后面是数据,
+// 每个流有单独的接收窗口, 一个流的数据没有被读取时不会阻塞其他流
+
+const (
+	frameOpen byte = iota
+	frameData
+	frameWindow
+	// 发送方不再发送数据, 对应 CloseWrite
+	frameClose
+	// 流被关闭, 对方不能再发送数据
+	frameReset
+)
+
+const (
+	muxHeaderSize = 9
+	muxFrameSize  = 32 << 10
+	// 每个流的接收窗口, 读取一半后通知对方
+	muxWindow = 256 << 10
+	// 每个连接最多同时打开的流
+	maxStreams = 1024
+)
+
+var (
+	errStreamReset  = errors.New("stream reset by peer")
+	errStreamClosed = errors.New("stream closed")
+)
+
+// Mux 连接断开后所有的流都返回错误
+type Mux struct {
+	conn net.Conn
+
+	writeLock sync.Mutex
+	lock      sync.Mutex
+	streams   map[uint32]*Stream
+	nextID    uint32
+
+	accept    chan *Stream
+	closed    chan struct{}
+	closeOnce sync.Once
+	err       error
+}
+
+func NewMux(conn net.Conn) *Mux {
+	m := &Mux{
+		conn:    conn,
+		streams: make(map[uint32]*Stream),
+		accept:  make(chan *Stream, 16),
+		closed:  make(chan struct{}),
+	}
+	go m.readLoop()
+	return m
+}
+
+// Open 打开一个新的流, 对方通过 Accept 接收
+func (m *Mux) Open() (*Stream, error) {
+	m.lock.Lock()
+	select {
+	case <-m.closed:
+		m.lock.Unlock()
+		return nil, m.err
+	default:
+	}
+	m.nextID++
+	s := newStream(m, m.nextID)
+	m.streams[s.id] = s
+	m.lock.Unlock()
+
+	if err := m.writeFrame(s.id, frameOpen, 0, nil); err != nil {
+		m.remove(s.id)
+		return nil, err
+	}
+	return s, nil
+}
+
+// Accept 等待对方打开的流, 连接断开后返回错误
+func (m *Mux) Accept() (*Stream, error) {
+	select {
+	case s := <-m.accept:
+		return s, nil
+	case <-m.closed:
+		return nil, m.err
+	}
+}
+
+// Close 关闭连接和所有的流
+func (m *Mux) Close() error {
+	m.close(errStreamClosed)
+	return nil
+}
+
+func (m *Mux) close(err error) {
+	m.closeOnce.Do(func() {
+		m.lock.Lock()
+		m.err = err
+		close(m.closed)
+		streams := m.streams
+		m.streams = make(map[uint32]*Stream)
+		m.lock.Unlock()
+
+		_ = m.conn.Close()
+		for _, s := range streams {
+			s.fail(err)
+		}
+	})
+}
+
+func (m *Mux) remove(id uint32) {
+	m.lock.Lock()
+	delete(m.streams, id)
+	m.lock.Unlock()
+}
+
+func (m *Mux) stream(id uint32) *Stream {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.streams[id]
+}
+
+// writeFrame 头部和数据一次写入, 多个流同时写入时不会交错
+func (m *Mux) writeFrame(id uint32, frameType byte, length uint32, data []byte) error {
+	buf := make([]byte, muxHeaderSize+len(data))
+	binary.BigEndian.PutUint32(buf[0:4], id)
+	buf[4] = frameType
+	binary.BigEndian.PutUint32(buf[5:9], length)
+	copy(buf[muxHeaderSize:], data)
+
+	m.writeLock.Lock()
+	_, err := m.conn.Write(buf)
+	m.writeLock.Unlock()
+	if err != nil {
+		m.close(err)
+	}
+	return err
+}
+
+func (m *Mux) readLoop() {
+	header := make([]byte, muxHeaderSize)
+	for {
+		if _, err := io.ReadFull(m.conn, header); err != nil {
+			// 连接断开时流还没有正常结束, 不能返回 EOF
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			m.close(err)
+			return
+		}
+		id := binary.BigEndian.Uint32(header[0:4])
+		length := binary.BigEndian.Uint32(header[5:9])
+		if err := m.handleFrame(id, header[4], length); err != nil {
+			m.close(err)
+			return
+		}
+	}
+}
+
+func (m *Mux) handleFrame(id uint32, frameType byte, length uint32) error {
+	switch frameType {
+	case frameOpen:
+		m.lock.Lock()
+		_, exist := m.streams[id]
+		full := len(m.streams) >= maxStreams
+		var s *Stream
+		if !exist && !full {
+			s = newStream(m, id)
+			m.streams[id] = s
+		}
+		m.lock.Unlock()
+		if exist {
+			return fmt.Errorf("mux stream %d already exists", id)
+		}
+		if full {
+			return m.writeFrame(id, frameReset, 0, nil)
+		}
+		select {
+		case m.accept <- s:
+		case <-m.closed:
+		}
+	case frameData:
+		if length > muxFrameSize {
+			return fmt.Errorf("mux frame len error: %d", length)
+		}
+		data := make([]byte, length)
+		if _, err := io.ReadFull(m.conn, data); err != nil {
+			return err
+		}
+		// 本地已经关闭的流直接丢弃, 对方收到 reset 后不再发送
+		if s := m.stream(id); s != nil {
+			return s.receive(data)
+		}
+	case frameWindow:
+		if s := m.stream(id); s != nil {
+			s.addCredit(int(length))
+		}
+	case frameClose:
+		if s := m.stream(id); s != nil {
+			s.remoteClose()
+		}
+	case frameReset:
+		if s := m.stream(id); s != nil {
+			m.remove(id)
+			s.fail(errStreamReset)
+		}
+	default:
+		return fmt.Errorf("mux frame type error: %d", frameType)
+	}
+	return nil
+}
+
+// Stream 复用连接上的一个流, 实现 net.Conn, 不支持超时
+type Stream struct {
+	mux *Mux
+	id  uint32
+
+	lock sync.Mutex
+	// 读写等待都使用同一个条件变量
+	cond   *sync.Cond
+	buffer bytes.Buffer
+	// 已经读取但是还没有通知对方的字节数
+	consumed int
+	// 对方剩余的接收窗口
+	credit int
+	// 对方不再发送数据, 读完缓存后返回 EOF
+	readClosed  bool
+	writeClosed bool
+	// 本地关闭, 收到 reset 或者连接断开
+	err error
+}
+
+func newStream(m *Mux, id uint32) *Stream {
+	s := &Stream{mux: m, id: id, credit: muxWindow}
+	s.cond = sync.NewCond(&s.lock)
+	return s
+}
+
+func (s *Stream) Read(p []byte) (int, error) {
+	s.lock.Lock()
+	for s.buffer.Len() == 0 {
+		if s.readClosed {
+			s.lock.Unlock()
+			return 0, io.EOF
+		}
+		if s.err != nil {
+			err := s.err
+			s.lock.Unlock()
+			return 0, err
+		}
+		s.cond.Wait()
+	}
+	n, _ := s.buffer.Read(p)
+	s.consumed += n
+	update := 0
+	if s.consumed >= muxWindow/2 {
+		update = s.consumed
+		s.consumed = 0
+	}
+	s.lock.Unlock()
+
+	if update > 0 {
+		_ = s.mux.writeFrame(s.id, frameWindow, uint32(update), nil)
+	}
+	return n, nil
+}
+
+func (s *Stream) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		s.lock.Lock()
+		for s.credit == 0 && s.err == nil && !s.writeClosed {
+			s.cond.Wait()
+		}
+		if s.err != nil || s.writeClosed {
+			err := s.err
+			if err == nil {
+				err = errStreamClosed
+			}
+			s.lock.Unlock()
+			return written, err
+		}
+		n := len(p)
+		if n > s.credit {
+			n = s.credit
+		}
+		if n > muxFrameSize {
+			n = muxFrameSize
+		}
+		s.credit -= n
+		s.lock.Unlock()
+
+		if err := s.mux.writeFrame(s.id, frameData, uint32(n), p[:n]); err != nil {
+			return written, err
+		}
+		written += n
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// CloseWrite 通知对方不再发送数据, 还可以继续读取
+func (s *Stream) CloseWrite() error {
+	s.lock.Lock()
+	if s.err != nil || s.writeClosed {
+		s.lock.Unlock()
+		return nil
+	}
+	s.writeClosed = true
+	s.cond.Broadcast()
+	s.lock.Unlock()
+	return s.mux.writeFrame(s.id, frameClose, 0, nil)
+}
+
+// Close 双方都已经 CloseWrite 时直接释放, 否则发送 reset 通知对方
+func (s *Stream) Close() error {
+	s.lock.Lock()
+	if s.err != nil {
+		s.lock.Unlock()
+		s.mux.remove(s.id)
+		return nil
+	}
+	reset := !s.readClosed || !s.writeClosed
+	s.err = errStreamClosed
+	s.cond.Broadcast()
+	s.lock.Unlock()
+
+	s.mux.remove(s.id)
+	if reset {
+		return s.mux.writeFrame(s.id, frameReset, 0, nil)
+	}
+	return nil
+}
+
+// receive 收到的数据超过接收窗口时是对方的协议错误, 断开整个连接
+func (s *Stream) receive(data []byte) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.buffer.Len()+s.consumed+len(data) > muxWindow {
+		return fmt.Errorf("mux stream %d window exceeded", s.id)
+	}
+	if s.err == nil && !s.readClosed {
+		s.buffer.Write(data)
+		s.cond.Broadcast()
+	}
+	return nil
+}
+
+func (s *Stream) addCredit(n int) {
+	s.lock.Lock()
+	s.credit += n
+	s.cond.Broadcast()
+	s.lock.Unlock()
+}
+
+func (s *Stream) remoteClose() {
+	s.lock.Lock()
+	s.readClosed = true
+	s.cond.Broadcast()
+	s.lock.Unlock()
+}
+
+func (s *Stream) fail(err error) {
+	s.lock.Lock()
+	if s.err == nil {
+		s.err = err
+	}
+	s.cond.Broadcast()
+	s.lock.Unlock()
+}
+
+func (s *Stream) LocalAddr() net.Addr {
+	return s.mux.conn.LocalAddr()
+}
+
+func (s *Stream) RemoteAddr() net.Addr {
+	return s.mux.conn.RemoteAddr()
+}
+
+func (s *Stream) SetDeadline(time.Time) error {
+	return errors.New("mux stream does not support deadline")
+}
+
+func (s *Stream) SetReadDeadline(time.Time) error {
+	return errors.New("mux stream does not support deadline")
+}
+
+func (s *Stream) SetWriteDeadline(time.Time) error {
+	return errors.New("mux stream does not support deadline")
+}
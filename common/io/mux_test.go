@@ -0,0 +1,164 @@
+package io
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newMuxPair 客户端 Open, 服务端把每个流的数据原样返回
+func newMuxPair(t *testing.T) (*Mux, *Mux) {
+	a, b := net.Pipe()
+	client, server := NewMux(a), NewMux(b)
+	t.Cleanup(func() {
+		_ = client.Close()
+		_ = server.Close()
+	})
+	return client, server
+}
+
+func echo(server *Mux) {
+	for {
+		stream, err := server.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			_, _ = io.Copy(stream, stream)
+			_ = stream.CloseWrite()
+			_ = stream.Close()
+		}()
+	}
+}
+
+func TestMuxConcurrentStreams(t *testing.T) {
+	client, server := newMuxPair(t)
+	go echo(server)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// 大于接收窗口, 需要窗口更新才能发送完
+			data := make([]byte, 3*muxWindow+123)
+			_, _ = rand.Read(data)
+
+			stream, err := client.Open()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer func() { _ = stream.Close() }()
+			go func() {
+				_, _ = stream.Write(data)
+				_ = stream.CloseWrite()
+			}()
+			got, err := io.ReadAll(stream)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("echo data mismatch: got %d bytes, want %d", len(got), len(data))
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestMuxStalledStream(t *testing.T) {
+	client, server := newMuxPair(t)
+	streams := make(chan *Stream, 2)
+	go func() {
+		for {
+			stream, err := server.Accept()
+			if err != nil {
+				return
+			}
+			streams <- stream
+		}
+	}()
+
+	// 第一个流写满窗口后没有人读取
+	stalled, err := client.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-streams
+	written := make(chan int, 1)
+	go func() {
+		n, _ := stalled.Write(make([]byte, 2*muxWindow))
+		written <- n
+	}()
+
+	// 第二个流不受影响
+	active, err := client.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	remote := <-streams
+	if _, err = active.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 4)
+	if _, err = io.ReadFull(remote, buf); err != nil || string(buf) != "ping" {
+		t.Fatalf("read active stream: %q %v", buf, err)
+	}
+
+	// 关闭后阻塞的写入返回, 最多写入一个窗口
+	_ = stalled.Close()
+	select {
+	case n := <-written:
+		if n > muxWindow {
+			t.Fatalf("stalled stream wrote %d bytes, window is %d", n, muxWindow)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("stalled write not released by close")
+	}
+}
+
+func TestMuxHalfClose(t *testing.T) {
+	client, server := newMuxPair(t)
+	go echo(server)
+
+	stream, err := client.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = stream.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	// CloseWrite 之后还能读到对方返回的数据
+	if err = stream.CloseWrite(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(stream)
+	if err != nil || string(got) != "hello" {
+		t.Fatalf("read after close write: %q %v", got, err)
+	}
+	if _, err = stream.Write([]byte("x")); err == nil {
+		t.Fatal("write after close write should fail")
+	}
+}
+
+func TestMuxConnClosed(t *testing.T) {
+	client, server := newMuxPair(t)
+	go echo(server)
+
+	stream, err := client.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = server.Close()
+	if _, err = io.ReadAll(stream); err == nil {
+		t.Fatal("read should fail after the connection is closed")
+	}
+	if _, err = client.Open(); err == nil {
+		t.Fatal("open should fail after the connection is closed")
+	}
+}
@@ -0,0 +1,237 @@
+package utils
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 上传的文件使用 tar.gz 格式, 可以边读边写, 不需要像 zip 一样读取末尾的目录
+
+// WriteArchive 只打包 files 中指定的文件, 路径相对于 baseDir, 文件内容直接从磁盘写入 w,
+// 保留权限位和修改时间, 清单中的软链接打包为链接
+func WriteArchive(w io.Writer, baseDir string, files []FileEntry) error {
+	gzipWriter := gzip.NewWriter(w)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	for _, entry := range files {
+		if err := archiveFile(baseDir, entry, tarWriter); err != nil {
+			return err
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		return err
+	}
+	return gzipWriter.Close()
+}
+
+func archiveFile(baseDir string, entry FileEntry, tarWriter *tar.Writer) error {
+	path := entry.Path
+	if entry.Link != "" {
+		return tarWriter.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeSymlink,
+			Name:     path,
+			Linkname: entry.Link,
+			Mode:     0777,
+			ModTime:  time.Unix(0, entry.ModTime),
+			Format:   tar.FormatPAX,
+		})
+	}
+
+	// 读取文件, 指向项目外面的软链接读取目标文件
+	file, err := os.Open(fmt.Sprintf("%s/%s", baseDir, path))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	// 写入 tar, 大小以打开时为准, 打包过程中文件被修改时返回错误,
+	// 使用 PAX 格式才能保存纳秒精度的修改时间, 否则会截断到秒
+	header := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     path,
+		Size:     info.Size(),
+		Mode:     int64(fileMode(info)),
+		ModTime:  info.ModTime(),
+		Format:   tar.FormatPAX,
+	}
+	if err = tarWriter.WriteHeader(header); err != nil {
+		return err
+	}
+	if _, err = io.CopyN(tarWriter, file, header.Size); err != nil {
+		return fmt.Errorf("archive %s error: %v", path, err)
+	}
+	return nil
+}
+
+// ArchiveLimits 解压的限制, 0 代表不限制
+type ArchiveLimits struct {
+	MaxFiles     int
+	MaxFileSize  int64
+	MaxTotalSize int64
+}
+
+// ExtractArchive 边读边解压到 outPath, 路径不合法, 软链接指向外面或者会写到 outPath 外面的文件直接返回错误,
+// 超过 limits 时返回 *LimitError, 出错时已经解压的文件不会删除
+func ExtractArchive(r io.Reader, outPath string, limits ArchiveLimits) error {
+	if err := os.MkdirAll(outPath, 0777); err != nil {
+		return err
+	}
+	gzipReader, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	tarReader := tar.NewReader(gzipReader)
+
+	var count int
+	var total int64
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return verifyLinks(outPath)
+		}
+		if err != nil {
+			return err
+		}
+		count++
+		if limits.MaxFiles > 0 && count > limits.MaxFiles {
+			return &LimitError{What: "archive file count", Size: int64(count), Limit: int64(limits.MaxFiles)}
+		}
+
+		path, err := SafeJoin(outPath, strings.TrimSuffix(header.Name, "/"))
+		if err != nil {
+			return fmt.Errorf("illegal file in archive: %v", err)
+		}
+		// 上级目录可能是之前部署的软链接
+		if err = VerifyRealPath(outPath, path); err != nil {
+			return fmt.Errorf("illegal file in archive: %v", err)
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err = os.MkdirAll(path, 0777); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			// tar 按照文件头中的大小读取内容, 写入前校验就能限制实际写入的大小
+			if err = limits.check(header.Name, header.Size, total); err != nil {
+				return err
+			}
+			if err = prepareFile(path); err != nil {
+				return err
+			}
+			if err = extractFile(tarReader, path, header); err != nil {
+				return err
+			}
+			total += header.Size
+		case tar.TypeSymlink:
+			if err = VerifyLink(strings.TrimSuffix(header.Name, "/"), header.Linkname); err != nil {
+				return fmt.Errorf("illegal file in archive: %v", err)
+			}
+			if err = prepareFile(path); err != nil {
+				return err
+			}
+			// 标准库不能修改软链接本身的修改时间, 只保留目标
+			if err = os.Symlink(filepath.FromSlash(header.Linkname), path); err != nil {
+				return err
+			}
+			// 按照真实的上级目录解析目标, 经过其他软链接后可能指向外面
+			if err = VerifyRealLink(outPath, path); err != nil {
+				_ = os.Remove(path)
+				return fmt.Errorf("illegal file in archive: %v", err)
+			}
+		default:
+			return fmt.Errorf("unsupported file type in archive: %s %q", header.Name, header.Typeflag)
+		}
+	}
+}
+
+// verifyLinks 解压完成后重新校验项目中所有的软链接, 后面的条目可能替换了链接经过的路径, 指向外面的链接直接删除
+func verifyLinks(outPath string) error {
+	var linkErr error
+	err := filepath.WalkDir(outPath, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.Type()&fs.ModeSymlink == 0 {
+			return nil
+		}
+		if err = VerifyRealLink(outPath, path); err != nil {
+			_ = os.Remove(path)
+			if linkErr == nil {
+				linkErr = fmt.Errorf("illegal file in archive: %v", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return linkErr
+}
+
+// check 已经解压 total 字节后再解压一个 size 字节的文件是否超过限制
+func (limits ArchiveLimits) check(name string, size, total int64) error {
+	if limits.MaxFileSize > 0 && size > limits.MaxFileSize {
+		return &LimitError{What: fmt.Sprintf("archive entry %s size", name), Size: size, Limit: limits.MaxFileSize}
+	}
+	if limits.MaxTotalSize > 0 && total+size > limits.MaxTotalSize {
+		return &LimitError{What: "archive total uncompressed size", Size: total + size, Limit: limits.MaxTotalSize}
+	}
+	return nil
+}
+
+// prepareFile 创建上级目录并删除已经存在的文件或者软链接, 避免通过旧的软链接写到其他文件
+func prepareFile(path string) error {
+	// 创建文件夹
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// extractFile 写入文件并恢复权限位和修改时间, 没有权限位时和之前一样使用默认权限
+func extractFile(reader io.Reader, path string, header *tar.Header) error {
+	mode := os.FileMode(header.Mode).Perm()
+	preserveMode := mode != 0
+	if !preserveMode {
+		mode = 0666
+	}
+
+	// 写入文件
+	writeFile, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(writeFile, reader); err != nil {
+		_ = writeFile.Close()
+		_ = os.Remove(path)
+		return err
+	}
+	if err = writeFile.Close(); err != nil {
+		return err
+	}
+
+	// 创建文件时的权限会受 umask 影响
+	if preserveMode {
+		if err = os.Chmod(path, mode); err != nil {
+			return err
+		}
+	}
+	if !header.ModTime.IsZero() {
+		return os.Chtimes(path, time.Now(), header.ModTime)
+	}
+	return nil
+}
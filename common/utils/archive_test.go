@@ -0,0 +1,258 @@
+package utils
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestArchiveRoundTrip(t *testing.T) {
+	src := t.TempDir()
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 123456789, time.Local)
+	if err := os.MkdirAll(filepath.Join(src, "bin"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "bin/mvnw"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Join(src, "bin/mvnw"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(filepath.Join(src, "bin/mvnw"), modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("bin", filepath.Join(src, "scripts")); err != nil {
+		t.Fatal(err)
+	}
+
+	manifest, err := BuildManifest(src, &IgnoreFilter{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buffer bytes.Buffer
+	if err = WriteArchive(&buffer, src, manifest); err != nil {
+		t.Fatal(err)
+	}
+	dst := t.TempDir()
+	if err = ExtractArchive(&buffer, dst, ArchiveLimits{}); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(filepath.Join(dst, "bin/mvnw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0755 {
+		t.Errorf("mode = %v, want 0755", info.Mode().Perm())
+	}
+	if !info.ModTime().Equal(modTime) {
+		t.Errorf("mod time = %v, want %v", info.ModTime(), modTime)
+	}
+	target, err := os.Readlink(filepath.Join(dst, "scripts"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target != "bin" {
+		t.Errorf("link target = %q, want %q", target, "bin")
+	}
+}
+
+// tarEntry 测试用的压缩包条目, link 不为空时是软链接
+type tarEntry struct {
+	name string
+	link string
+	body string
+}
+
+func buildArchive(t *testing.T, entries []tarEntry) *bytes.Buffer {
+	var buffer bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buffer)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for _, entry := range entries {
+		header := &tar.Header{Name: entry.name, Mode: 0644, Typeflag: tar.TypeReg, Size: int64(len(entry.body))}
+		if entry.link != "" {
+			header = &tar.Header{Name: entry.name, Linkname: entry.link, Mode: 0777, Typeflag: tar.TypeSymlink}
+		}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tarWriter.Write([]byte(entry.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buffer
+}
+
+func TestExtractArchiveMalicious(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []tarEntry
+		// 解压前在项目目录中创建的软链接, 模拟之前部署留下的文件, 目标中的 OUTSIDE 替换为外部目录
+		prior  map[string]string
+		limits ArchiveLimits
+		limit  bool
+	}{
+		{name: "parent entry", entries: []tarEntry{{name: "../evil", body: "x"}}},
+		{name: "nested parent entry", entries: []tarEntry{{name: "a/../../evil", body: "x"}}},
+		{name: "absolute entry", entries: []tarEntry{{name: "/tmp/evil", body: "x"}}},
+		{name: "drive entry", entries: []tarEntry{{name: "C:/evil", body: "x"}}},
+		{name: "drive relative entry", entries: []tarEntry{{name: "C:evil", body: "x"}}},
+		{name: "backslash entry", entries: []tarEntry{{name: "..\\evil", body: "x"}}},
+		{name: "parent symlink", entries: []tarEntry{{name: "link", link: "../outside"}}},
+		{name: "absolute symlink", entries: []tarEntry{{name: "link", link: "/tmp"}}},
+		{
+			// 每个软链接字面上都合法, 组合后 self/up 指向项目目录的上级, 再通过它写入文件
+			name: "escaping symlink then write through it",
+			entries: []tarEntry{
+				{name: "self", link: "."},
+				{name: "self/up", link: ".."},
+				{name: "self/up/evil", body: "x"},
+			},
+		},
+		{
+			// 目标经过另一个软链接后指向外面
+			name: "symlink through sibling symlink",
+			entries: []tarEntry{
+				{name: "self", link: "."},
+				{name: "up", link: "self/.."},
+			},
+		},
+		{
+			// 创建时 y 指向项目目录, 后面替换 z 之后指向外面
+			name: "symlink path replaced by a later entry",
+			entries: []tarEntry{
+				{name: "a/f", body: "x"},
+				{name: "z", link: "a"},
+				{name: "y", link: "z/.."},
+				{name: "z", link: "."},
+			},
+		},
+		{
+			name:    "prior deploy symlink parent",
+			prior:   map[string]string{"dir": "OUTSIDE"},
+			entries: []tarEntry{{name: "dir/evil", body: "x"}},
+		},
+		{
+			name:    "prior deploy symlink grandparent",
+			prior:   map[string]string{"dir": "OUTSIDE"},
+			entries: []tarEntry{{name: "dir/new/evil", body: "x"}},
+		},
+		{
+			name:    "file count limit",
+			entries: []tarEntry{{name: "a", body: "x"}, {name: "b", body: "x"}},
+			limits:  ArchiveLimits{MaxFiles: 1},
+			limit:   true,
+		},
+		{
+			name:    "file size limit",
+			entries: []tarEntry{{name: "a", body: "0123456789"}},
+			limits:  ArchiveLimits{MaxFileSize: 5},
+			limit:   true,
+		},
+		{
+			name:    "total size limit",
+			entries: []tarEntry{{name: "a", body: "01234"}, {name: "b", body: "56789"}},
+			limits:  ArchiveLimits{MaxTotalSize: 8},
+			limit:   true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			root := t.TempDir()
+			outPath := filepath.Join(root, "project")
+			outside := filepath.Join(root, "outside")
+			for _, dir := range []string{outPath, outside} {
+				if err := os.MkdirAll(dir, 0777); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for name, target := range test.prior {
+				if target == "OUTSIDE" {
+					target = outside
+				}
+				if err := os.Symlink(target, filepath.Join(outPath, name)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := ExtractArchive(buildArchive(t, test.entries), outPath, test.limits)
+			if err == nil {
+				t.Fatal("extract malicious archive should fail")
+			}
+			if IsLimitError(err) != test.limit {
+				t.Errorf("limit error = %v, want %v: %v", IsLimitError(err), test.limit, err)
+			}
+			// 不能留下指向项目目录外面的软链接, 之前部署留下的链接除外
+			walkErr := filepath.WalkDir(outPath, func(path string, entry fs.DirEntry, err error) error {
+				if err != nil || entry.Type()&fs.ModeSymlink == 0 {
+					return err
+				}
+				name, _ := filepath.Rel(outPath, path)
+				if _, prior := test.prior[name]; prior {
+					return nil
+				}
+				real, err := filepath.EvalSymlinks(path)
+				if err != nil {
+					t.Errorf("resolve symlink %s: %v", name, err)
+					return nil
+				}
+				if rel, _ := filepath.Rel(outPath, real); rel == ".." || strings.HasPrefix(rel, "../") {
+					t.Errorf("symlink %s points outside the project: %s", name, real)
+				}
+				return nil
+			})
+			if walkErr != nil {
+				t.Fatal(walkErr)
+			}
+			// 项目目录外面不能有任何文件
+			for _, path := range []string{filepath.Join(root, "evil"), filepath.Join(outside, "evil"), filepath.Join(outside, "new")} {
+				if _, statErr := os.Lstat(path); statErr == nil {
+					t.Errorf("file written outside the project: %s", path)
+				}
+			}
+		})
+	}
+}
+
+// TestExtractArchiveReplaceSymlink 已经存在的软链接被同名文件替换, 不能通过它写到链接的目标
+func TestExtractArchiveReplaceSymlink(t *testing.T) {
+	root := t.TempDir()
+	outPath := filepath.Join(root, "project")
+	if err := os.MkdirAll(outPath, 0777); err != nil {
+		t.Fatal(err)
+	}
+	target := filepath.Join(root, "target")
+	if err := os.WriteFile(target, []byte("keep"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, filepath.Join(outPath, "file")); err != nil {
+		t.Fatal(err)
+	}
+
+	archive := buildArchive(t, []tarEntry{{name: "file", body: "new"}})
+	if err := ExtractArchive(archive, outPath, ArchiveLimits{}); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(target); err != nil || string(data) != "keep" {
+		t.Errorf("symlink target changed: %q %v", data, err)
+	}
+	info, err := os.Lstat(filepath.Join(outPath, "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		t.Error("file is still a symlink")
+	}
+}
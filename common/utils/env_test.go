@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseEnvFile(t *testing.T) {
+	data := strings.Join([]string{
+		"# comment",
+		"",
+		"   ",
+		"  # indented comment",
+		"A=1",
+		"export B=2",
+		"  C = 3  ",
+		"EMPTY=",
+		"D=value # comment",
+		"E=a#b",
+		`F="a # b"`,
+		`G='a # b'`,
+		`H="line\nnext\ttab\"quote\\"`,
+		`I='raw\n'`,
+		`J="a" # comment`,
+		"K=a=b",
+	}, "\n")
+	env, err := ParseEnvFile([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"A":     "1",
+		"B":     "2",
+		"C":     "3",
+		"EMPTY": "",
+		"D":     "value",
+		"E":     "a#b",
+		"F":     "a # b",
+		"G":     "a # b",
+		"H":     "line\nnext\ttab\"quote\\",
+		"I":     `raw\n`,
+		"J":     "a",
+		"K":     "a=b",
+	}
+	if !reflect.DeepEqual(env, want) {
+		t.Fatalf("ParseEnvFile = %q, want %q", env, want)
+	}
+}
+
+func TestParseEnvFileError(t *testing.T) {
+	tests := []struct {
+		data string
+		err  string
+	}{
+		{"A=1\nNOVALUE", "line 2: expected KEY=VALUE"},
+		{"=1", "line 1: expected KEY=VALUE"},
+		{"A B=1", "line 1: expected KEY=VALUE"},
+		{`A="abc`, "line 1: unterminated \" quote"},
+		{"A='abc", "line 1: unterminated ' quote"},
+	}
+	for _, test := range tests {
+		_, err := ParseEnvFile([]byte(test.data))
+		if err == nil || err.Error() != test.err {
+			t.Errorf("ParseEnvFile(%q) error = %v, want %q", test.data, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// 忽略文件的语法和 .gitignore 一致: https://git-scm.com/docs/gitignore
+
+const (
+	GitIgnoreFile     = ".gitignore"
+	ProjectIgnoreFile = ".remotedebugignore"
+)
+
+// ignoreRule 忽略文件中的一行规则
+type ignoreRule struct {
+	// 忽略文件所在的目录, 相对于项目根目录, 以 / 结尾, 根目录为空
+	base string
+	// 包含 / 的规则相对于 base 逐级匹配, ** 匹配任意层目录
+	segments []string
+	// 不包含 / 的规则匹配 base 下任意层级的文件名
+	name    string
+	negate  bool
+	dirOnly bool
+}
+
+// IgnoreRules 忽略规则, 后面的规则优先级更高
+type IgnoreRules []ignoreRule
+
+// ParseIgnore 解析忽略文件, base 是忽略文件所在的目录, 以 / 结尾, 根目录为空
+func ParseIgnore(data []byte, base string) IgnoreRules {
+	rules := make(IgnoreRules, 0)
+	for _, line := range strings.Split(string(data), "\n") {
+		line = trimIgnoreLine(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		rule := ignoreRule{base: base}
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		// 开头或者中间有 / 的规则只匹配相对于 base 的路径
+		if strings.Contains(line, "/") {
+			rule.segments = strings.Split(strings.TrimPrefix(line, "/"), "/")
+		} else {
+			rule.name = line
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// trimIgnoreLine 去掉换行符和末尾没有转义的空格, \# \! 和 \ 这样的转义由 path.Match 处理
+func trimIgnoreLine(line string) string {
+	line = strings.TrimSuffix(line, "\r")
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+		line = line[:len(line)-1]
+	}
+	return line
+}
+
+// Match 返回最后一条匹配 filePath 的规则是否忽略, filePath 使用 / 分隔并且相对于项目根目录
+func (rules IgnoreRules) Match(filePath string, isDir bool) (matched, ignored bool) {
+	for i := len(rules) - 1; i >= 0; i-- {
+		if rules[i].match(filePath, isDir) {
+			return true, !rules[i].negate
+		}
+	}
+	return false, false
+}
+
+func (rule ignoreRule) match(filePath string, isDir bool) bool {
+	if rule.dirOnly && !isDir {
+		return false
+	}
+	if !strings.HasPrefix(filePath, rule.base) {
+		return false
+	}
+	rel := filePath[len(rule.base):]
+	if rule.segments == nil {
+		ok, _ := path.Match(rule.name, path.Base(rel))
+		return ok
+	}
+	return matchSegments(rule.segments, strings.Split(rel, "/"))
+}
+
+// matchSegments 逐级匹配路径, ** 匹配零或多层目录, 结尾的 ** 匹配目录中的所有文件, 但不匹配目录本身
+func matchSegments(pattern, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+	if pattern[0] == "**" {
+		if len(pattern) == 1 {
+			return len(segments) > 0
+		}
+		for i := 0; i <= len(segments); i++ {
+			if matchSegments(pattern[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segments) == 0 {
+		return false
+	}
+	ok, _ := path.Match(pattern[0], segments[0])
+	return ok && matchSegments(pattern[1:], segments[1:])
+}
+
+// IgnoreFilter 选择需要上传的文件
+type IgnoreFilter struct {
+	// 任意层级都忽略的文件名
+	names map[string]int8
+	// 是否读取每个目录中的 .gitignore
+	gitIgnore bool
+	// 项目根目录的 .remotedebugignore, 优先级高于所有 .gitignore
+	project IgnoreRules
+}
+
+// NewIgnoreFilter names 是逗号分隔的文件名, 项目根目录有 .remotedebugignore 时一起读取
+func NewIgnoreFilter(baseDir, names string, gitIgnore bool) (*IgnoreFilter, error) {
+	filter := &IgnoreFilter{names: make(map[string]int8), gitIgnore: gitIgnore}
+	for _, name := range strings.Split(names, ",") {
+		if name != "" {
+			filter.names[name] = 1
+		}
+	}
+	data, err := os.ReadFile(fmt.Sprintf("%s/%s", baseDir, ProjectIgnoreFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	filter.project = ParseIgnore(data, "")
+	return filter, nil
+}
+
+// dirRules 进入目录 dir 时加上目录中 .gitignore 的规则, dir 以 / 结尾, 根目录为空
+func (filter *IgnoreFilter) dirRules(baseDir, dir string, parent IgnoreRules) (IgnoreRules, error) {
+	if !filter.gitIgnore {
+		return parent, nil
+	}
+	data, err := os.ReadFile(fmt.Sprintf("%s/%s%s", baseDir, dir, GitIgnoreFile))
+	if os.IsNotExist(err) {
+		return parent, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// 不能修改父目录的规则, 同级的其他目录还要使用
+	return append(parent[:len(parent):len(parent)], ParseIgnore(data, dir)...), nil
+}
+
+// ignored 判断文件是否需要跳过, rules 是文件所在目录生效的 .gitignore 规则
+func (filter *IgnoreFilter) ignored(filePath string, isDir bool, rules IgnoreRules) bool {
+	if _, ignore := filter.names[path.Base(filePath)]; ignore {
+		return true
+	}
+	if matched, ignored := filter.project.Match(filePath, isDir); matched {
+		return ignored
+	}
+	_, ignored := rules.Match(filePath, isDir)
+	return ignored
+}
@@ -0,0 +1,131 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestIgnoreRules(t *testing.T) {
+	tests := []struct {
+		rules   string
+		path    string
+		isDir   bool
+		ignored bool
+	}{
+		// 不包含 / 的规则匹配任意层级
+		{"*.log", "a.log", false, true},
+		{"*.log", "a/b/c.log", false, true},
+		{"*.log", "a.txt", false, false},
+		// 开头的 / 只匹配根目录
+		{"/a.log", "a.log", false, true},
+		{"/a.log", "sub/a.log", false, false},
+		// 中间有 / 的规则也相对于根目录
+		{"doc/*.txt", "doc/a.txt", false, true},
+		{"doc/*.txt", "sub/doc/a.txt", false, false},
+		{"doc/*.txt", "doc/sub/a.txt", false, false},
+		// dir/ 只匹配目录
+		{"build/", "build", true, true},
+		{"build/", "build", false, false},
+		{"build/", "sub/build", true, true},
+		// **
+		{"**/foo", "foo", false, true},
+		{"**/foo", "a/b/foo", false, true},
+		{"a/**/b", "a/b", false, true},
+		{"a/**/b", "a/x/y/b", false, true},
+		{"a/**/b", "c/a/b", false, false},
+		{"a/**", "a/x/y", false, true},
+		{"a/**", "a", true, false},
+		// 取反, 后面的规则优先
+		{"*.log\n!keep.log", "keep.log", false, false},
+		{"*.log\n!keep.log", "a.log", false, true},
+		{"!keep.log\n*.log", "keep.log", false, true},
+		// 注释, 转义和末尾空格
+		{"# a.log", "# a.log", false, false},
+		{"\\#a.log", "#a.log", false, true},
+		{"\\!a.log", "!a.log", false, true},
+		{"a.log   ", "a.log", false, true},
+		{"a.log\r", "a.log", false, true},
+	}
+	for _, test := range tests {
+		_, ignored := ParseIgnore([]byte(test.rules), "").Match(test.path, test.isDir)
+		if ignored != test.ignored {
+			t.Errorf("rules %q match %q (dir %v) = %v, want %v", test.rules, test.path, test.isDir, ignored, test.ignored)
+		}
+	}
+}
+
+func TestIgnoreRulesBase(t *testing.T) {
+	// sub/.gitignore 中的规则只作用于 sub 下的文件
+	rules := ParseIgnore([]byte("/a.log\n*.tmp"), "sub/")
+	tests := []struct {
+		path    string
+		ignored bool
+	}{
+		{"sub/a.log", true},
+		{"sub/x/a.log", false},
+		{"a.log", false},
+		{"sub/x/b.tmp", true},
+		{"b.tmp", false},
+	}
+	for _, test := range tests {
+		if _, ignored := rules.Match(test.path, false); ignored != test.ignored {
+			t.Errorf("match %q = %v, want %v", test.path, ignored, test.ignored)
+		}
+	}
+}
+
+func TestBuildManifestIgnore(t *testing.T) {
+	base := t.TempDir()
+	files := map[string]string{
+		".gitignore": "*.log\nbuild/*\n!build/keep.txt\nlogs/\n!logs/keep.txt\n",
+		// 忽略的目录中的文件不能重新包含, 和 git 一致
+		"logs/keep.txt":  "",
+		"logs/a.txt":     "",
+		"build/a.class":  "",
+		"build/keep.txt": "",
+		"a.log":          "",
+		"a.txt":          "",
+		// 子目录的 .gitignore 优先级高于父目录
+		"sub/.gitignore": "!keep.log\n*.txt\n",
+		"sub/keep.log":   "",
+		"sub/a.log":      "",
+		"sub/a.txt":      "",
+		"sub/b.java":     "",
+		"other/a.txt":    "",
+		// .remotedebugignore 优先级高于所有 .gitignore
+		ProjectIgnoreFile: "other/\n!sub/b.txt\n",
+		"sub/b.txt":       "",
+		"node/x.js":       "",
+	}
+	for name, data := range files {
+		path := filepath.Join(base, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	filter, err := NewIgnoreFilter(base, "node", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := BuildManifest(base, filter, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make([]string, 0, len(manifest))
+	for _, entry := range manifest {
+		got = append(got, entry.Path)
+	}
+	sort.Strings(got)
+	want := []string{".gitignore", ProjectIgnoreFile, "a.txt", "build/keep.txt", "sub/.gitignore", "sub/b.java", "sub/b.txt", "sub/keep.log"}
+	sort.Strings(want)
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("manifest = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,23 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+)
+
+// LimitError 数据超过了服务端配置的限制
+type LimitError struct {
+	What  string
+	Size  int64
+	Limit int64
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s %d exceeds the limit %d", e.What, e.Size, e.Limit)
+}
+
+// IsLimitError 判断错误是否由超过限制引起, 包括被包装过的错误
+func IsLimitError(err error) bool {
+	var limitErr *LimitError
+	return errors.As(err, &limitErr)
+}
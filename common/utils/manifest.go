@@ -0,0 +1,214 @@
+package utils
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+type FileEntry struct {
+	Path    string `json:"Path"`
+	Size    int64  `json:"Size"`
+	ModTime int64  `json:"ModTime"`
+	Hash    string `json:"Hash"`
+	// 权限位, 0 代表客户端不支持, 服务端使用默认权限
+	Mode uint32 `json:"Mode,omitempty"`
+	// 软链接的目标, 不为空时没有文件内容
+	Link string `json:"Link,omitempty"`
+}
+
+// BuildManifest 遍历项目生成文件清单, 跳过 filter 忽略的文件, cache 中大小和修改时间都没变的文件直接复用之前的 hash
+func BuildManifest(baseDir string, filter *IgnoreFilter, cache []FileEntry) ([]FileEntry, error) {
+	manifest := make([]FileEntry, 0)
+	if err := doManifest(baseDir, "", filter, nil, cacheMap(cache), &manifest); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// BuildManifestFiles 按照 files 生成文件清单, 路径相对于 baseDir, 不存在的文件和目录直接跳过
+func BuildManifestFiles(baseDir string, files []string, cache []FileEntry) ([]FileEntry, error) {
+	cached := cacheMap(cache)
+	manifest := make([]FileEntry, 0, len(files))
+	for _, path := range files {
+		if fileInfo, err := os.Lstat(fmt.Sprintf("%s/%s", baseDir, path)); err != nil || fileInfo.IsDir() {
+			continue
+		}
+		entry, ok, err := manifestEntry(baseDir, path, cached)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			manifest = append(manifest, entry)
+		}
+	}
+	return manifest, nil
+}
+
+func cacheMap(cache []FileEntry) map[string]FileEntry {
+	cached := make(map[string]FileEntry, len(cache))
+	for _, entry := range cache {
+		cached[entry.Path] = entry
+	}
+	return cached
+}
+
+func doManifest(baseDir, abDir string, filter *IgnoreFilter, rules IgnoreRules, cacheMap map[string]FileEntry, manifest *[]FileEntry) error {
+	dir, err := os.ReadDir(fmt.Sprintf("%s/%s", baseDir, abDir))
+	if err != nil {
+		return err
+	}
+	// 加上当前目录 .gitignore 中的规则
+	if rules, err = filter.dirRules(baseDir, abDir, rules); err != nil {
+		return err
+	}
+	for _, dirEntry := range dir {
+		// 判断是否要跳过
+		path := fmt.Sprintf("%s%s", abDir, dirEntry.Name())
+		if filter.ignored(path, dirEntry.IsDir(), rules) {
+			continue
+		}
+
+		// 递归遍历所有文件夹
+		if dirEntry.IsDir() {
+			if err = doManifest(baseDir, path+"/", filter, rules, cacheMap, manifest); err != nil {
+				return err
+			}
+			continue
+		}
+
+		entry, ok, err := manifestEntry(baseDir, path, cacheMap)
+		if err != nil {
+			return err
+		}
+		if ok {
+			*manifest = append(*manifest, entry)
+		}
+	}
+	return nil
+}
+
+// manifestEntry 生成单个文件的清单, 指向项目内部的软链接保留为链接, 指向外部的软链接按照目标文件上传,
+// 管道和设备等特殊文件直接跳过
+func manifestEntry(baseDir, path string, cacheMap map[string]FileEntry) (FileEntry, bool, error) {
+	fullPath := fmt.Sprintf("%s/%s", baseDir, path)
+	fileInfo, err := os.Lstat(fullPath)
+	if err != nil {
+		return FileEntry{}, false, err
+	}
+	if fileInfo.Mode()&os.ModeSymlink != 0 {
+		target, err := projectLink(baseDir, path)
+		if err != nil {
+			return FileEntry{}, false, err
+		}
+		if target != "" {
+			return FileEntry{Path: path, ModTime: fileInfo.ModTime().UnixNano(), Link: target}, true, nil
+		}
+		if fileInfo, err = os.Stat(fullPath); err != nil {
+			return FileEntry{}, false, err
+		}
+		if fileInfo.IsDir() {
+			return FileEntry{}, false, fmt.Errorf("symlink to a directory outside the project is not supported: %s", path)
+		}
+	}
+	if !fileInfo.Mode().IsRegular() {
+		return FileEntry{}, false, nil
+	}
+	entry := FileEntry{Path: path, Size: fileInfo.Size(), ModTime: fileInfo.ModTime().UnixNano(), Mode: fileMode(fileInfo)}
+
+	// 文件没变化则不需要重新计算 hash
+	if cached, exist := cacheMap[path]; exist && cached.Size == entry.Size && cached.ModTime == entry.ModTime {
+		entry.Hash = cached.Hash
+	} else if entry.Hash, err = HashFile(fullPath); err != nil {
+		return FileEntry{}, false, err
+	}
+	return entry, true, nil
+}
+
+// projectLink 读取软链接的目标, 指向 baseDir 内部的绝对路径转换成相对路径, 指向外部时返回空字符串
+func projectLink(baseDir, path string) (string, error) {
+	fullPath := fmt.Sprintf("%s/%s", baseDir, path)
+	target, err := os.Readlink(fullPath)
+	if err != nil {
+		return "", err
+	}
+	if filepath.IsAbs(target) {
+		absPath, err := filepath.Abs(fullPath)
+		if err != nil {
+			return "", nil
+		}
+		if target, err = filepath.Rel(filepath.Dir(absPath), target); err != nil {
+			return "", nil
+		}
+	}
+	target = filepath.ToSlash(target)
+	if VerifyLink(path, target) != nil {
+		return "", nil
+	}
+	return target, nil
+}
+
+// fileMode 文件的权限位, windows 没有可执行权限, 返回 0 由服务端使用默认权限
+func fileMode(fileInfo os.FileInfo) uint32 {
+	if runtime.GOOS == "windows" {
+		return 0
+	}
+	return uint32(fileInfo.Mode().Perm())
+}
+
+func HashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = file.Close() }()
+
+	hash := sha1.New()
+	if _, err = io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// DiffManifest 对比新旧清单, 返回需要上传的文件和需要删除的文件, 权限和软链接目标变化也需要重新上传
+// 旧清单中的文件如果在 baseDir 中被删除, 类型或者大小不一致也需要重新上传
+func DiffManifest(baseDir string, oldManifest, newManifest []FileEntry) (need []string, remove []string) {
+	oldMap := make(map[string]FileEntry, len(oldManifest))
+	for _, entry := range oldManifest {
+		oldMap[entry.Path] = entry
+	}
+
+	need = make([]string, 0)
+	for _, entry := range newManifest {
+		old, exist := oldMap[entry.Path]
+		delete(oldMap, entry.Path)
+		if exist && old.Hash == entry.Hash && old.Mode == entry.Mode && old.Link == entry.Link && sameOnDisk(baseDir, entry) {
+			continue
+		}
+		need = append(need, entry.Path)
+	}
+
+	remove = make([]string, 0, len(oldMap))
+	for path := range oldMap {
+		remove = append(remove, path)
+	}
+	return
+}
+
+// sameOnDisk 判断 baseDir 中的文件类型和大小是否和清单一致, 软链接比较目标
+func sameOnDisk(baseDir string, entry FileEntry) bool {
+	path := fmt.Sprintf("%s/%s", baseDir, entry.Path)
+	fileInfo, err := os.Lstat(path)
+	if err != nil {
+		return false
+	}
+	if entry.Link != "" {
+		target, err := os.Readlink(path)
+		return err == nil && filepath.ToSlash(target) == entry.Link
+	}
+	return fileInfo.Mode().IsRegular() && fileInfo.Size() == entry.Size
+}
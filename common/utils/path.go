@@ -0,0 +1,167 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// VerifyPath 校验客户端传来的相对路径, 只能使用 / 分隔, 不能是绝对路径, 不能包含 .. 和空字符
+func VerifyPath(name string) error {
+	if name == "" {
+		return fmt.Errorf("empty path")
+	}
+	if strings.ContainsAny(name, "\\\x00") {
+		return fmt.Errorf("illegal character in path: %q", name)
+	}
+	// windows 的盘符也算绝对路径
+	if strings.HasPrefix(name, "/") || filepath.VolumeName(name) != "" || (len(name) > 1 && name[1] == ':') {
+		return fmt.Errorf("absolute path is not allowed: %q", name)
+	}
+	for _, element := range strings.Split(name, "/") {
+		if element == ".." {
+			return fmt.Errorf("path escapes the target directory: %q", name)
+		}
+	}
+	return nil
+}
+
+// SafeJoin 把客户端传来的相对路径拼接到 baseDir 下, 结果不在 baseDir 中时返回错误
+func SafeJoin(baseDir, name string) (string, error) {
+	if err := VerifyPath(name); err != nil {
+		return "", err
+	}
+	path := filepath.Join(baseDir, filepath.FromSlash(name))
+	rel, err := filepath.Rel(baseDir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("path escapes the target directory: %q", name)
+	}
+	return path, nil
+}
+
+// VerifyLink 校验软链接 name 的目标, 只能是相对路径, 并且按照字面解析后仍然在 name 所在的根目录中
+func VerifyLink(name, target string) error {
+	if target == "" || strings.ContainsAny(target, "\\\x00") {
+		return fmt.Errorf("illegal symlink target: %s -> %q", name, target)
+	}
+	if strings.HasPrefix(target, "/") || filepath.VolumeName(target) != "" || (len(target) > 1 && target[1] == ':') {
+		return fmt.Errorf("absolute symlink is not allowed: %s -> %s", name, target)
+	}
+	if resolved := path.Join(path.Dir(name), target); resolved == ".." || strings.HasPrefix(resolved, "../") {
+		return fmt.Errorf("symlink escapes the target directory: %s -> %s", name, target)
+	}
+	return nil
+}
+
+// VerifyRealPath 校验 filePath 最近的已经存在的上级目录解析软链接后仍然在 baseDir 中,
+// 字面校验无法发现 a -> . 这种链接和 .. 组合后指向外面的情况, 写入文件前需要再校验一次
+func VerifyRealPath(baseDir, filePath string) error {
+	realBase, err := filepath.EvalSymlinks(baseDir)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(filePath)
+	for {
+		if _, err = os.Lstat(dir); err == nil {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(realBase, realDir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("path escapes the target directory through a symlink: %q", filePath)
+	}
+	return nil
+}
+
+// VerifyRealLink 从软链接 linkPath 所在目录的真实路径开始逐级解析链接的目标, 中间的软链接也会解析,
+// 字面校验无法发现 self -> . 和 self/up -> .. 这种组合, 创建链接后需要再校验一次
+func VerifyRealLink(baseDir, linkPath string) error {
+	realBase, err := filepath.EvalSymlinks(baseDir)
+	if err != nil {
+		return err
+	}
+	dir, err := filepath.EvalSymlinks(filepath.Dir(linkPath))
+	if err != nil {
+		return err
+	}
+	target, err := os.Readlink(linkPath)
+	if err != nil {
+		return err
+	}
+	resolved, err := resolveLink(dir, target)
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(realBase, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("symlink escapes the target directory: %q -> %q", linkPath, target)
+	}
+	return nil
+}
+
+// resolveLink 在 dir 中按照操作系统的规则解析 target, 遇到软链接时展开, 不存在的部分按照字面拼接
+func resolveLink(dir, target string) (string, error) {
+	current := dir
+	pending := splitPath(target)
+	if filepath.IsAbs(target) {
+		current = filepath.VolumeName(target) + string(filepath.Separator)
+	}
+	links := 0
+	for len(pending) > 0 {
+		element := pending[0]
+		pending = pending[1:]
+		switch element {
+		case "", ".":
+			continue
+		case "..":
+			current = filepath.Dir(current)
+			continue
+		}
+
+		next := filepath.Join(current, element)
+		info, err := os.Lstat(next)
+		if os.IsNotExist(err) {
+			current = next
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			current = next
+			continue
+		}
+
+		// 和操作系统一样限制展开的次数, 避免循环链接
+		if links++; links > 255 {
+			return "", fmt.Errorf("too many levels of symbolic links: %q", next)
+		}
+		link, err := os.Readlink(next)
+		if err != nil {
+			return "", err
+		}
+		if filepath.IsAbs(link) {
+			current = filepath.VolumeName(link) + string(filepath.Separator)
+		}
+		pending = append(splitPath(link), pending...)
+	}
+	return current, nil
+}
+
+// splitPath 按照分隔符拆分路径, 不做 Clean, .. 需要在解析软链接之后处理
+func splitPath(path string) []string {
+	path = path[len(filepath.VolumeName(path)):]
+	return strings.FieldsFunc(path, func(r rune) bool { return r < utf8.RuneSelf && os.IsPathSeparator(uint8(r)) })
+}
@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSafeJoin(t *testing.T) {
+	base := t.TempDir()
+	tests := []struct {
+		name string
+		ok   bool
+	}{
+		{"a.txt", true},
+		{"src/main/A.java", true},
+		{"a/./b", true},
+		{"..a/b", true},
+		{"", false},
+		{"..", false},
+		{"../evil", false},
+		{"a/../../evil", false},
+		{"a/..", false},
+		{"/etc/passwd", false},
+		{"C:/Windows/evil", false},
+		{"C:evil", false},
+		{"a\\..\\evil", false},
+		{"a\x00b", false},
+	}
+	for _, test := range tests {
+		path, err := SafeJoin(base, test.name)
+		if (err == nil) != test.ok {
+			t.Errorf("SafeJoin(%q) error = %v, want ok %v", test.name, err, test.ok)
+			continue
+		}
+		if err == nil {
+			if rel, relErr := filepath.Rel(base, path); relErr != nil || rel == ".." || filepath.IsAbs(rel) {
+				t.Errorf("SafeJoin(%q) = %q, outside %q", test.name, path, base)
+			}
+		}
+	}
+}
+
+func TestVerifyLink(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		ok     bool
+	}{
+		{"scripts", "bin", true},
+		{"a/b", "../c", true},
+		{"a/b", ".", true},
+		{"a", ".", true},
+		{"a", "..", false},
+		{"a/b", "../../c", false},
+		{"a", "../outside", false},
+		{"a", "/etc", false},
+		{"a", "C:/Windows", false},
+		{"a", "C:x", false},
+		{"a", "..\\x", false},
+		{"a", "", false},
+	}
+	for _, test := range tests {
+		err := VerifyLink(test.name, test.target)
+		if (err == nil) != test.ok {
+			t.Errorf("VerifyLink(%q, %q) error = %v, want ok %v", test.name, test.target, err, test.ok)
+		}
+	}
+}
+
+func TestVerifyRealPath(t *testing.T) {
+	root := t.TempDir()
+	base := filepath.Join(root, "project")
+	outside := filepath.Join(root, "outside")
+	for _, dir := range []string{filepath.Join(base, "dir"), outside} {
+		if err := os.MkdirAll(dir, 0777); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		// 字面上合法, 组合后指向外面
+		"self":     ".",
+		"self/up":  "..",
+		"escape":   outside,
+		"internal": "dir",
+	}
+	for _, name := range []string{"self", "self/up", "escape", "internal"} {
+		if err := os.Symlink(links[name], filepath.Join(base, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		ok   bool
+	}{
+		{"a.txt", true},
+		{"dir/a.txt", true},
+		{"new/dir/a.txt", true},
+		{"internal/a.txt", true},
+		{"self/a.txt", true},
+		{"self/up/evil", false},
+		{"escape/evil", false},
+		{"escape/new/dir/evil", false},
+	}
+	for _, test := range tests {
+		err := VerifyRealPath(base, filepath.Join(base, test.name))
+		if (err == nil) != test.ok {
+			t.Errorf("VerifyRealPath(%q) error = %v, want ok %v", test.name, err, test.ok)
+		}
+	}
+}
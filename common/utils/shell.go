@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SplitArgs 按照 shell 的规则拆分参数, 支持单引号, 双引号和反斜杠转义, 不支持变量替换
+func SplitArgs(s string) ([]string, error) {
+	args := make([]string, 0)
+	var arg strings.Builder
+	// 引号中的空字符串也是一个参数
+	hasArg := false
+	// 当前所在的引号, 0 代表不在引号中
+	var quote rune
+	escape := false
+
+	for _, c := range s {
+		switch {
+		case escape:
+			// 双引号中的反斜杠只转义 " \ $ `
+			if quote == '"' && !strings.ContainsRune("\"\\$`", c) {
+				arg.WriteRune('\\')
+			}
+			arg.WriteRune(c)
+			escape = false
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			} else {
+				arg.WriteRune(c)
+			}
+		case c == '\\':
+			escape = true
+			hasArg = true
+		case quote == '"':
+			if c == '"' {
+				quote = 0
+			} else {
+				arg.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			hasArg = true
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			if hasArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				hasArg = false
+			}
+		default:
+			arg.WriteRune(c)
+			hasArg = true
+		}
+	}
+
+	if escape {
+		return nil, fmt.Errorf("unexpected end after backslash: %s", s)
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote: %s", quote, s)
+	}
+	if hasArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		s    string
+		args []string
+		ok   bool
+	}{
+		{"", []string{}, true},
+		{"  \t\n ", []string{}, true},
+		{"-Xmx1g  -Da=b", []string{"-Xmx1g", "-Da=b"}, true},
+		// 单引号中的内容原样保留
+		{`'a b' 'c\d' '"'`, []string{"a b", `c\d`, `"`}, true},
+		// 双引号中的反斜杠只转义 " \ $ `
+		{`"a b" "c\"d" "e\\f" "\$x" "\n"`, []string{"a b", `c"d`, `e\f`, "$x", `\n`}, true},
+		// 引号外的反斜杠转义任意字符
+		{`a\ b c\'d \\`, []string{"a b", "c'd", `\`}, true},
+		// 引号拼接成一个参数
+		{`-Dname="a b"'c'd`, []string{"-Dname=a bcd"}, true},
+		// 空引号也是一个参数
+		{`"" a ''`, []string{"", "a", ""}, true},
+		{`"abc`, nil, false},
+		{`'abc`, nil, false},
+		{`a "b'`, nil, false},
+		{`abc\`, nil, false},
+	}
+	for _, test := range tests {
+		args, err := SplitArgs(test.s)
+		if (err == nil) != test.ok {
+			t.Errorf("SplitArgs(%q) error = %v, want ok %v", test.s, err, test.ok)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(args, test.args) {
+			t.Errorf("SplitArgs(%q) = %q, want %q", test.s, args, test.args)
+		}
+	}
+}
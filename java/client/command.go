@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"remote-debug/common/io"
+	"remote-debug/java/common"
+	"strconv"
+	"time"
+)
+
+// sendRequest 发送不需要上传项目的请求, 失败时直接退出
+func sendRequest(requestType string) common.Result {
+	if requestType != common.RequestList {
+		verifyProjectName()
+	}
+
+	conn := connectServer()
+	defer func() { _ = conn.Close() }()
+	sendRequestType(conn, requestType)
+
+	return readResult(conn)
+}
+
+func readResult(conn net.Conn) common.Result {
+	result := common.Result{}
+	if err := io.ReadMessage(conn, &result); err != nil {
+		common.Exit("read result error", err)
+	}
+	// restart 失败时旧进程也可能已经停止
+	if result.Code != 200 && result.Stop != nil {
+		printStop(result.Stop)
+	}
+	if result.Code != 200 {
+		common.Exit(fmt.Sprintf("%s error: %d %s", command, result.Code, result.Msg), nil)
+	}
+	return result
+}
+
+func verifyProjectName() {
+	if projectName == "" && projectInfo.ProjectPath != "" {
+		projectName = common.ProjectName(projectInfo.ProjectPath)
+	}
+	if projectName == "" {
+		common.Exit("place input project name param: -n <project name> or -p <project path>", nil)
+	}
+	if err := common.VerifyProjectName(projectName); err != nil {
+		common.Exit("project name error", err)
+	}
+}
+
+func printProcesses(processes []common.ProcessStatus) {
+	fmt.Printf("%-16s %-30s %-8s %-10s %-6s %-14s %-20s %-10s %s\n",
+		"USER", "PROJECT", "PID", "STATE", "DEBUG", "RESTARTS", "START TIME", "UPTIME", "LAST EXIT")
+	for _, p := range processes {
+		// 崩溃循环中等待重启
+		state := p.State
+		if p.CrashLoop && state == common.StateBackoff {
+			state = "crashloop"
+		}
+		lastExit := "-"
+		if p.LastExit != nil {
+			if p.LastExit.Error != "" {
+				lastExit = "wait error"
+			} else if p.LastExit.Signal != "" {
+				lastExit = fmt.Sprintf("signal %s", p.LastExit.Signal)
+			} else {
+				lastExit = fmt.Sprintf("code %d", p.LastExit.Code)
+			}
+			lastExit = fmt.Sprintf("%s at %s", lastExit, time.UnixMilli(p.LastExit.Time).Format("2006-01-02 15:04:05"))
+		}
+		debugPort := "-"
+		if p.DebugPort != 0 {
+			debugPort = strconv.Itoa(p.DebugPort)
+		}
+		uptime := time.Duration(p.Uptime) * time.Millisecond
+		fmt.Printf("%-16s %-30s %-8d %-10s %-6s %-14s %-20s %-10s %s\n", p.User, p.Project, p.Pid, state, debugPort,
+			fmt.Sprintf("%d/%s", p.Restarts, p.RestartPolicy),
+			time.UnixMilli(p.StartTime).Format("2006-01-02 15:04:05"), uptime.Truncate(time.Second), lastExit)
+	}
+}
+
+func restart() {
+	verifyProjectName()
+
+	conn := connectServer()
+	defer func() { _ = conn.Close() }()
+	sendRequestType(conn, common.RequestRestart)
+	result := readResult(conn)
+	if result.Stop != nil {
+		printStop(result.Stop)
+	}
+	fmt.Println(command, "success:", result.Msg)
+	if result.DebugPort != 0 {
+		fmt.Println("debug port:", result.DebugPort)
+	}
+
+	if follow {
+		printOutput(conn)
+	}
+}
+
+func logs() {
+	verifyProjectName()
+
+	conn := connectServer()
+	defer func() { _ = conn.Close() }()
+	sendRequestType(conn, common.RequestLogs)
+	readResult(conn)
+
+	printOutput(conn)
+}
+
+// printStop 打印旧进程停止的结果
+func printStop(info *common.StopInfo) {
+	fmt.Println("stop old process:", info.Describe())
+}
+
+// printOutput 打印服务端发送的输出直到结束
+func printOutput(conn net.Conn) {
+	for {
+		output := common.Output{}
+		if err := io.ReadMessage(conn, &output); err != nil {
+			common.Exit("read output error", err)
+		}
+		if output.End {
+			return
+		}
+		_, _ = os.Stdout.Write(output.Data)
+	}
+}
+
+// printBuildFailure 打印构建失败摘要, 编译错误使用本地路径输出 path:line:column 方便在 IDE 中点击跳转
+func printBuildFailure(failure *common.BuildFailure) {
+	fmt.Printf("build failure: module %s, phase %s", failure.Module, failure.Phase)
+	if failure.Goal != "" {
+		fmt.Printf(", goal %s", failure.Goal)
+	}
+	fmt.Println()
+	for _, compileError := range failure.Errors {
+		path := compileError.File
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(projectInfo.ProjectPath, filepath.FromSlash(path))
+		}
+		if compileError.Column > 0 {
+			fmt.Printf("%s:%d:%d: %s\n", path, compileError.Line, compileError.Column, compileError.Message)
+		} else {
+			fmt.Printf("%s:%d: %s\n", path, compileError.Line, compileError.Message)
+		}
+	}
+}
+
+// printHotswap 打印热替换的类或者重启的原因
+func printHotswap(info *common.HotswapInfo) {
+	if !info.Swapped {
+		fmt.Println("hotswap not possible, restarted:", info.Reason)
+		return
+	}
+	fmt.Printf("hotswap success: %d classes redefined\n", len(info.Classes))
+	for _, class := range info.Classes {
+		fmt.Println("  " + class)
+	}
+}
+
+// parseSince 支持相对时间 10m 和绝对时间 2006-01-02 15:04:05
+func parseSince(since string) (time.Time, error) {
+	if duration, err := time.ParseDuration(since); err == nil {
+		return time.Now().Add(-duration), nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02"} {
+		if sinceTime, err := time.ParseInLocation(layout, since, time.Local); err == nil {
+			return sinceTime, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unknown time format: %s", since)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"remote-debug/common/utils"
+	"strings"
+)
+
+// selectFiles 选择需要上传的文件并生成清单, -git 时只使用 git 跟踪的文件, 否则按照忽略规则遍历项目
+func selectFiles(cache []utils.FileEntry) ([]utils.FileEntry, error) {
+	if gitFiles {
+		files, err := gitTrackedFiles(projectInfo.ProjectPath)
+		if err != nil {
+			return nil, err
+		}
+		return utils.BuildManifestFiles(projectInfo.ProjectPath, files, cache)
+	}
+
+	filter, err := utils.NewIgnoreFilter(projectInfo.ProjectPath, ignore, gitIgnore)
+	if err != nil {
+		return nil, err
+	}
+	return utils.BuildManifest(projectInfo.ProjectPath, filter, cache)
+}
+
+// gitTrackedFiles git 跟踪的文件, 上传工作区中的内容, 所以包括还没提交的修改, 已经删除的文件在生成清单时跳过
+func gitTrackedFiles(projectPath string) ([]string, error) {
+	cmd := exec.Command("git", "ls-files", "-z", "--cached")
+	cmd.Dir = projectPath
+	output, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return nil, fmt.Errorf("git ls-files error: %s", strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, err
+	}
+
+	// 有冲突的文件每个版本都会输出一次
+	files := make([]string, 0)
+	exist := make(map[string]bool)
+	for _, path := range strings.Split(string(output), "\x00") {
+		if path != "" && !exist[path] {
+			exist[path] = true
+			files = append(files, path)
+		}
+	}
+	return files, nil
+}
+
+// printFiles -dry-run 打印将要上传的文件和总大小
+func printFiles(manifest []utils.FileEntry) {
+	var total int64
+	for _, entry := range manifest {
+		if entry.Link != "" {
+			fmt.Printf("%12s  %s -> %s\n", "link", entry.Path, entry.Link)
+			continue
+		}
+		fmt.Printf("%12d  %s\n", entry.Size, entry.Path)
+		total += entry.Size
+	}
+	fmt.Printf("total: %d files, %d bytes\n", len(manifest), total)
+}
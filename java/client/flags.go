@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// listFlag 可以重复指定的参数, 按照顺序保存
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, " ")
+}
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// mapFlag 可以重复指定的 key=value 参数
+type mapFlag map[string]string
+
+func (m mapFlag) String() string {
+	pairs := make([]string, 0, len(m))
+	for key, value := range m {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", key, value))
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (m mapFlag) Set(value string) error {
+	key, value, _ := strings.Cut(value, "=")
+	if key == "" {
+		return fmt.Errorf("name is empty")
+	}
+	m[key] = value
+	return nil
+}
+
+// normalizeArgs 把 java 风格的 -Dkey=value 和 -J-Xmx512m 转换成 flag 包能识别的 -D=key=value 和 -J=-Xmx512m
+func normalizeArgs(args []string) []string {
+	normalized := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			return append(normalized, args[i:]...)
+		}
+		switch {
+		case len(arg) > 2 && strings.HasPrefix(arg, "-D") && arg[2] != '=':
+			arg = "-D=" + arg[2:]
+		case len(arg) > 2 && strings.HasPrefix(arg, "-J-"):
+			arg = "-J=" + arg[2:]
+		}
+		normalized = append(normalized, arg)
+
+		// 需要值的参数, 下一个参数原样保留, 比如 -param -Dkey=value
+		if takesValue(arg) && i+1 < len(args) {
+			i++
+			normalized = append(normalized, args[i])
+		}
+	}
+	return normalized
+}
+
+// takesValue 判断是不是后面跟着值的参数, 比如 -c a.Main
+func takesValue(arg string) bool {
+	if !strings.HasPrefix(arg, "-") || strings.Contains(arg, "=") {
+		return false
+	}
+	f := flag.CommandLine.Lookup(strings.TrimLeft(arg, "-"))
+	if f == nil {
+		return false
+	}
+	if boolFlag, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && boolFlag.IsBoolFlag() {
+		return false
+	}
+	return true
+}
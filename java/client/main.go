@@ -1,10 +1,13 @@
 package main
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
 	"flag"
 	"fmt"
 	"net"
 	"os"
+	"path/filepath"
 	"remote-debug/common/io"
 	"remote-debug/common/utils"
 	"remote-debug/java/common"
@@ -15,13 +18,37 @@ import (
 var (
 	serverAddrS = "0.0.0.0:50005"
 	ignore      = ".git,.idea,target"
+	gitIgnore   = true
+	gitFiles    bool
+	dryRun      bool
 
 	projectInfo = common.ProjectInfo{}
+	projectName string
+	params      string
+	envFiles    []string
+	envAllow    string
+
+	follow bool
+	tail   = -1
+	since  string
+
+	tunnelAddr   = "127.0.0.1:5005"
+	forwardFlags []string
+
+	command = common.RequestDeploy
 )
 
+// 写入失败后等待服务端结果的时间
+const sendErrorTimeout = 5 * time.Second
+
 func init() {
 	flag.StringVar(&serverAddrS, "s", serverAddrS, "server address: 0.0.0.0:50005")
-	flag.StringVar(&ignore, "i", ignore, "ignore: .git,.idea,target")
+	flag.StringVar(&ignore, "i", ignore, "ignore files with these names at any level: .git,.idea,target")
+	flag.BoolVar(&gitIgnore, "gitignore", gitIgnore,
+		"skip files matched by .gitignore files, .remotedebugignore in the project path is always used")
+	flag.BoolVar(&gitFiles, "git", gitFiles,
+		"send exactly the files tracked by git (git ls-files) with uncommitted changes, -i and ignore files are not used")
+	flag.BoolVar(&dryRun, "dry-run", dryRun, "deploy/hotswap: list the files that would be sent and their total size, then exit")
 
 	flag.StringVar(&projectInfo.ProjectPath, "p", "",
 		"project path: C:\\Users\\Lee\\IdeaProjects\\remote-debug-test")
@@ -29,31 +56,138 @@ func init() {
 		"module path: service\\app")
 	flag.StringVar(&projectInfo.RunClass, "c", "",
 		"run class path: io.lihongbin.remote.debug.test.RemoteDebugTestApplication")
-	flag.StringVar(&projectInfo.Params, "param", "",
-		"params: -agentlib:jdwp=transport=dt_socket,server=y,suspend=n,address=5005")
+	flag.StringVar(&params, "param", "",
+		"jvm options, split like shell: \"-Xmx512m -Dspring.profiles.active=dev\"")
+	flag.Var((*listFlag)(&projectInfo.JvmOptions), "J",
+		"jvm option, can be repeated: -J-Xmx512m")
+	projectInfo.SystemProperties = make(map[string]string)
+	flag.Var(mapFlag(projectInfo.SystemProperties), "D",
+		"system property, can be repeated: -Dspring.profiles.active=dev")
+	flag.Var((*listFlag)(&projectInfo.ProgramArgs), "arg",
+		"program argument after the run class, can be repeated: --arg --server.port=8080")
+	flag.StringVar(&projectInfo.BuildTool, "build", "",
+		"build tool: maven or gradle, default detect by pom.xml or build.gradle")
+	flag.StringVar(&projectInfo.Scope, "scope", common.ScopeRuntime,
+		"classpath scope: runtime or test")
+	flag.StringVar(&projectInfo.RestartPolicy, "restart", common.RestartNever,
+		"restart policy: never, on-failure or always")
+	flag.IntVar(&projectInfo.MaxRetries, "max-retries", 5,
+		"on-failure max restart times, 0 no limit")
+	flag.IntVar(&projectInfo.StopTimeout, "stop-timeout", 0,
+		"seconds to wait for the process to exit after SIGTERM before SIGKILL, 0 use server default")
+	flag.StringVar(&projectInfo.PreStop, "pre-stop", "",
+		"command run in the project directory on the server before stopping, pid in $REMOTE_DEBUG_PID")
+	flag.BoolVar(&projectInfo.Debug, "debug", false,
+		"let the server allocate a debug port and start the JDWP agent")
+	flag.BoolVar(&projectInfo.DebugSuspend, "suspend", false,
+		"with -debug, wait for the debugger to attach before running main (suspend=y)")
+	projectInfo.Env = make(map[string]string)
+	flag.Var(mapFlag(projectInfo.Env), "e",
+		"environment variable, can be repeated: -e SPRING_PROFILES_ACTIVE=dev")
+	flag.Var((*listFlag)(&envFiles), "env-file",
+		"read environment variables from a .env file, can be repeated, -e takes precedence")
+	flag.BoolVar(&projectInfo.CleanEnv, "clean-env", false,
+		"do not inherit the server environment, only keep variables in -env-allow")
+	flag.StringVar(&envAllow, "env-allow", "",
+		"server environment variables kept by -clean-env: PATH,HOME,LC_*")
+	flag.StringVar(&projectName, "n", "",
+		"project name, default last path segment of -p")
 
-	flag.Parse()
+	flag.BoolVar(&follow, "f", follow, "logs: follow new output, deploy/restart: stay attached and print output until Ctrl-C")
+	flag.IntVar(&tail, "tail", tail, "logs: only print the last N lines, -1 print all")
+	flag.StringVar(&since, "since", since, "logs: only print lines after this time: 10m or 2006-01-02 15:04:05")
+	flag.StringVar(&tunnelAddr, "local", tunnelAddr, "tunnel: local listen address, the debugger attaches to it: 5005 or 127.0.0.1:5005")
+	flag.Var((*listFlag)(&forwardFlags), "L",
+		"tunnel: forward a local port to a port the project listens on, can be repeated: -L 8080:8080 or -L 0.0.0.0:18080:8080")
+
+	// 第一个参数不是 - 开头则作为子命令
+	args := normalizeArgs(os.Args[1:])
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command = args[0]
+		args = args[1:]
+	}
+	flag.Usage = usage
+	_ = flag.CommandLine.Parse(args)
+
+	// 子命令也可以放在参数后面
+	if flag.NArg() > 0 {
+		command = flag.Arg(0)
+		_ = flag.CommandLine.Parse(flag.Args()[1:])
+	}
 
 	// 校验环境参数是否正确
 	common.VerifyParam()
 }
 
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [deploy|hotswap|stop|restart|status|logs|list|tunnel] [options]\n", os.Args[0])
+	fmt.Fprintln(flag.CommandLine.Output(), "  deploy   upload, build and start the project (default)")
+	fmt.Fprintln(flag.CommandLine.Output(), "  hotswap  upload and build, redefine changed classes in the running project, restart if not possible")
+	fmt.Fprintln(flag.CommandLine.Output(), "  stop     stop the project")
+	fmt.Fprintln(flag.CommandLine.Output(), "  restart  restart the project without rebuilding")
+	fmt.Fprintln(flag.CommandLine.Output(), "  status   show pid and uptime of the project")
+	fmt.Fprintln(flag.CommandLine.Output(), "  logs     print the project log")
+	fmt.Fprintln(flag.CommandLine.Output(), "  list     list all projects on the server")
+	fmt.Fprintln(flag.CommandLine.Output(), "  tunnel   forward a local port to the debug port of the project, or to project ports with -L,")
+	fmt.Fprintln(flag.CommandLine.Output(), "           all local connections share one authenticated server connection,")
+	fmt.Fprintln(flag.CommandLine.Output(), "           JDWP only listens on the server loopback by default, so attach the debugger through the tunnel")
+	flag.PrintDefaults()
+}
+
 func main() {
+	switch command {
+	case common.RequestDeploy:
+		deploy()
+	case common.RequestHotswap:
+		// 重启后的进程也需要调试端口, 下次才能热替换
+		projectInfo.Debug = true
+		deploy()
+	case common.RequestStop:
+		result := sendRequest(command)
+		fmt.Println(command, "success:", result.Msg)
+	case common.RequestRestart:
+		restart()
+	case common.RequestStatus, common.RequestList:
+		result := sendRequest(command)
+		printProcesses(result.Processes)
+	case common.RequestLogs:
+		logs()
+	case common.RequestTunnel:
+		tunnel()
+	default:
+		usage()
+		common.Exit(fmt.Sprintf("unknown command: %s", command), nil)
+	}
+}
+
+func deploy() {
 	// 校验参数
 	verifyParam()
 	fmt.Println("verify param success")
 
-	// 打包项目
-	zipData := projectToZip()
+	// 生成文件清单
+	manifest := buildManifest()
+	if dryRun {
+		printFiles(manifest)
+		return
+	}
 
 	// 连接服务器
 	conn := connectServer()
+	defer func() { _ = conn.Close() }()
 
 	// 上传参数
+	sendRequestType(conn, command)
 	sendParam(conn)
 
-	// 上传文件
-	sendData(conn, zipData)
+	// 上传清单
+	syncPlan := sendManifest(conn, manifest)
+
+	// 打包并上传文件
+	sendFiles(conn, manifest, syncPlan.Need)
+
+	// 打印构建输出
+	printOutput(conn)
 
 	// 获取返回结果
 	result := common.Result{}
@@ -61,6 +195,26 @@ func main() {
 		common.Exit("read result error", err)
 	}
 	fmt.Println("read result success: ", result.Code, result.Msg)
+	if result.Stop != nil {
+		printStop(result.Stop)
+	}
+	if result.Build != nil {
+		printBuildFailure(result.Build)
+	}
+	if result.Code != 200 {
+		os.Exit(1)
+	}
+	if result.DebugPort != 0 {
+		fmt.Println("debug port:", result.DebugPort)
+	}
+	if result.Hotswap != nil {
+		printHotswap(result.Hotswap)
+	}
+
+	// 持续输出项目日志
+	if follow {
+		printOutput(conn)
+	}
 }
 
 func verifyParam() {
@@ -71,6 +225,12 @@ func verifyParam() {
 	if _, err := os.Stat(projectInfo.ProjectPath); err != nil {
 		common.Exit("project path error", err)
 	}
+	if projectName == "" {
+		projectName = common.ProjectName(projectInfo.ProjectPath)
+	}
+	if err := common.VerifyProjectName(projectName); err != nil {
+		common.Exit("project name error, set a valid name with -n", err)
+	}
 	if projectInfo.ModulePath == "" {
 		common.Exit("place input module path param: -m <module path>", nil)
 	}
@@ -85,42 +245,195 @@ func verifyParam() {
 		strings.ReplaceAll(projectInfo.RunClass, ".", "/"))); err != nil {
 		common.Exit("run class error", err)
 	}
+	// -param 放在其他 JVM 参数前面
+	if params != "" {
+		jvmOptions, err := utils.SplitArgs(params)
+		if err != nil {
+			common.Exit("param error", err)
+		}
+		projectInfo.JvmOptions = append(jvmOptions, projectInfo.JvmOptions...)
+	}
+	// 后面的文件覆盖前面的, -e 优先级最高
+	fileEnv := make(map[string]string)
+	for _, envFile := range envFiles {
+		data, err := os.ReadFile(envFile)
+		if err != nil {
+			common.Exit("read env file error", err)
+		}
+		env, err := utils.ParseEnvFile(data)
+		if err != nil {
+			common.Exit(fmt.Sprintf("parse env file %s error", envFile), err)
+		}
+		for key, value := range env {
+			fileEnv[key] = value
+		}
+	}
+	for key, value := range fileEnv {
+		if _, exist := projectInfo.Env[key]; !exist {
+			projectInfo.Env[key] = value
+		}
+	}
+	if envAllow != "" {
+		projectInfo.EnvAllowlist = strings.Split(envAllow, ",")
+	}
 }
 
-func projectToZip() []byte {
+func buildManifest() []utils.FileEntry {
 	startTime := time.Now()
-	zipData, err := utils.Zip(projectInfo.ProjectPath, ignore)
+
+	// 读取上次的清单缓存, 没变化的文件不需要重新计算 hash
+	cachePath := manifestCachePath()
+	cache := make([]utils.FileEntry, 0)
+	if data, err := os.ReadFile(cachePath); err == nil {
+		_ = io.ToObj(data, &cache)
+	}
+
+	manifest, err := selectFiles(cache)
 	if err != nil {
-		common.Exit("package zip error", err)
+		common.Exit("build manifest error", err)
+	}
+
+	// 保存缓存, 失败了也不影响上传
+	if data, err := io.ToByte(manifest); err == nil {
+		_ = os.MkdirAll(filepath.Dir(cachePath), 0777)
+		_ = os.WriteFile(cachePath, data, 0666)
 	}
+
 	endTime := time.Now()
 	projectInfo.ZipTime = int(endTime.UnixMilli() - startTime.UnixMilli())
-	return zipData
+	fmt.Printf("build manifest success: %d files, %dms\n", len(manifest), projectInfo.ZipTime)
+	return manifest
 }
 
-func connectServer() *net.TCPConn {
-	serverAddr, err := net.ResolveTCPAddr("tcp", serverAddrS)
+func manifestCachePath() string {
+	cacheDir, err := os.UserCacheDir()
 	if err != nil {
-		common.Exit("resolve tcp addr error", err)
+		cacheDir = os.TempDir()
 	}
-	conn, err := net.DialTCP("tcp", nil, serverAddr)
+	absPath, err := filepath.Abs(projectInfo.ProjectPath)
 	if err != nil {
-		common.Exit("dial tcp error", err)
+		absPath = projectInfo.ProjectPath
+	}
+	hash := sha1.Sum([]byte(absPath))
+	return fmt.Sprintf("%s/remote-debug/manifest/%s.json", cacheDir, hex.EncodeToString(hash[:]))
+}
+
+// sendFiles 边打包边上传, 文件内容直接从磁盘写入连接, 不在内存中缓存
+func sendFiles(conn net.Conn, manifest []utils.FileEntry, need []string) {
+	startTime := time.Now()
+	entries := make(map[string]utils.FileEntry, len(manifest))
+	for _, entry := range manifest {
+		entries[entry.Path] = entry
+	}
+	files := make([]utils.FileEntry, 0, len(need))
+	for _, path := range need {
+		files = append(files, entries[path])
+	}
+
+	writer := io.NewChunkWriter(conn)
+	if err := utils.WriteArchive(writer, projectInfo.ProjectPath, files); err != nil {
+		exitSendError(conn, "send files error", err)
+	}
+	if err := writer.Close(); err != nil {
+		exitSendError(conn, "send files error", err)
+	}
+	endTime := time.Now()
+	fmt.Printf("send files success: %d files, %d bytes, %dms\n", len(files), writer.Total(), endTime.UnixMilli()-startTime.UnixMilli())
+}
+
+// exitSendError 服务端拒绝请求 (比如超过大小限制) 时会返回结果后断开, 客户端还在发送数据就会写入失败,
+// 这时先尝试读取服务端的结果, 读不到时再输出写入错误
+func exitSendError(conn net.Conn, msg string, err error) {
+	_ = conn.SetReadDeadline(time.Now().Add(sendErrorTimeout))
+	// 上传失败时结果前面还有构建输出的结束消息
+	for i := 0; i < 2; i++ {
+		reply := struct {
+			common.Output
+			common.Result
+		}{}
+		if io.ReadMessage(conn, &reply) != nil {
+			break
+		}
+		if reply.Code != 0 && reply.Code != 200 {
+			common.Exit(fmt.Sprintf("%s error: %d %s", command, reply.Code, reply.Msg), nil)
+		}
+	}
+	common.Exit(msg, err)
+}
+
+func connectServer() net.Conn {
+	if common.User == "" {
+		common.Exit("place input user param: -user <user name>", nil)
+	}
+	conn, err := dialServer()
+	if err != nil {
+		common.Exit("connect server error", err)
 	}
-	defer func() { _ = conn.Close() }()
 	fmt.Println("connect server success")
+	fmt.Println("authenticate success")
 	return conn
 }
 
-func sendParam(conn *net.TCPConn) {
+// dialServer 连接服务器并认证, 失败时返回错误
+func dialServer() (net.Conn, error) {
+	conn, err := common.Dial(serverAddrS)
+	if err != nil {
+		return nil, fmt.Errorf("dial tcp error: %v", err)
+	}
+	if err = common.Handshake(conn, common.AuthKey, common.User); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("authenticate error: %v", err)
+	}
+	return conn, nil
+}
+
+func sendRequestType(conn net.Conn, requestType string) {
+	request := common.Request{Type: requestType, Project: projectName, Follow: follow, Tail: tail}
+	if since != "" {
+		sinceTime, err := parseSince(since)
+		if err != nil {
+			common.Exit("since param error", err)
+		}
+		request.Since = sinceTime.UnixMilli()
+	}
+	if err := io.SendMessage(conn, &request); err != nil {
+		common.Exit("send request error", err)
+	}
+}
+
+func sendParam(conn net.Conn) {
 	if err := io.SendMessage(conn, &projectInfo); err != nil {
-		common.Exit("send project info error", err)
+		exitSendError(conn, "send project info error", err)
 	}
 	fmt.Println("send project info success")
 }
 
-func sendData(conn *net.TCPConn, zipData []byte) {
-	if err := io.SendData(conn, zipData); err != nil {
-		common.Exit("send zip data error", err)
+func sendManifest(conn net.Conn, manifest []utils.FileEntry) common.SyncPlan {
+	if err := io.SendMessage(conn, &common.Manifest{Files: manifest}); err != nil {
+		exitSendError(conn, "send manifest error", err)
+	}
+	// 服务端拒绝部署时返回 Result 代替同步计划
+	reply := struct {
+		common.SyncPlan
+		common.Result
+	}{}
+	if err := io.ReadMessage(conn, &reply); err != nil {
+		common.Exit("read sync plan error", err)
+	}
+	if reply.Code != 0 && reply.Code != 200 {
+		common.Exit(fmt.Sprintf("%s error: %d %s", command, reply.Code, reply.Msg), nil)
+	}
+
+	// 只上传清单中的文件, 不能让服务端读取项目以外的文件
+	paths := make(map[string]bool, len(manifest))
+	for _, entry := range manifest {
+		paths[entry.Path] = true
+	}
+	for _, path := range reply.Need {
+		if !paths[path] {
+			common.Exit(fmt.Sprintf("sync plan error, file not in manifest: %q", path), nil)
+		}
 	}
+	fmt.Printf("send manifest success, need upload %d files\n", len(reply.Need))
+	return reply.SyncPlan
 }
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"remote-debug/common/io"
+	"remote-debug/java/common"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// forward 本地监听地址和服务端的端口, port 为 0 代表项目的调试端口
+type forward struct {
+	local string
+	port  int
+}
+
+// tunnelMux 所有本地连接复用同一个认证后的连接, 断开后下一个本地连接重新建立
+type tunnelMux struct {
+	lock sync.Mutex
+	mux  *io.Mux
+}
+
+// tunnel 监听本地端口, 每个本地连接在复用的连接上打开一个流, 由服务端转发到项目的端口
+func tunnel() {
+	result := sendRequest(common.RequestStatus)
+	if len(result.Processes) == 0 {
+		common.Exit(fmt.Sprintf("no find project: %s", projectName), nil)
+	}
+	status := result.Processes[0]
+
+	forwards := make([]forward, 0, len(forwardFlags))
+	for _, flagValue := range forwardFlags {
+		f, err := parseForward(flagValue)
+		if err != nil {
+			common.Exit("-L param error", err)
+		}
+		forwards = append(forwards, f)
+	}
+	// 没有 -L 时转发调试端口
+	if len(forwards) == 0 {
+		if status.DebugPort == 0 {
+			common.Exit(fmt.Sprintf("project is not started with -debug: %s", projectName), nil)
+		}
+		local := tunnelAddr
+		if !strings.Contains(local, ":") {
+			local = "127.0.0.1:" + local
+		}
+		forwards = append(forwards, forward{local: local})
+	}
+
+	listeners := make([]net.Listener, 0, len(forwards))
+	for _, f := range forwards {
+		listener, err := net.Listen("tcp", f.local)
+		if err != nil {
+			common.Exit("listen tunnel error", err)
+		}
+		listeners = append(listeners, listener)
+		if f.port == 0 {
+			fmt.Printf("tunnel %s -> %s debug port %d, attach the debugger to %s\n",
+				listener.Addr(), projectName, status.DebugPort, listener.Addr())
+		} else {
+			fmt.Printf("tunnel %s -> %s port %d\n", listener.Addr(), projectName, f.port)
+		}
+	}
+
+	t := &tunnelMux{}
+	if _, err := t.connect(); err != nil {
+		common.Exit("tunnel connect server error", err)
+	}
+	errs := make(chan error, len(listeners))
+	for i, listener := range listeners {
+		go serveTunnel(t, listener, forwards[i].port, errs)
+	}
+	common.Exit("accept tunnel error", <-errs)
+}
+
+// parseForward 解析 -L [bind_address:]localPort:remotePort, 默认只监听本机
+func parseForward(s string) (forward, error) {
+	parts := strings.Split(s, ":")
+	host := "127.0.0.1"
+	switch len(parts) {
+	case 2:
+	case 3:
+		host = parts[0]
+		parts = parts[1:]
+	default:
+		return forward{}, fmt.Errorf("expected [bind_address:]localPort:remotePort: %s", s)
+	}
+	localPort, err := strconv.Atoi(parts[0])
+	if err != nil || localPort < 0 || localPort > 65535 {
+		return forward{}, fmt.Errorf("local port error: %s", s)
+	}
+	remotePort, err := strconv.Atoi(parts[1])
+	if err != nil || remotePort <= 0 || remotePort > 65535 {
+		return forward{}, fmt.Errorf("remote port error: %s", s)
+	}
+	return forward{local: net.JoinHostPort(host, parts[0]), port: remotePort}, nil
+}
+
+// connect 建立认证后的连接并切换到复用模式
+func (t *tunnelMux) connect() (*io.Mux, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.mux != nil {
+		return t.mux, nil
+	}
+
+	conn, err := dialServer()
+	if err != nil {
+		return nil, err
+	}
+	request := common.Request{Type: common.RequestTunnel, Project: projectName}
+	if err = io.SendMessage(conn, &request); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("send tunnel request error: %v", err)
+	}
+	result := common.Result{}
+	if err = io.ReadMessage(conn, &result); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("read tunnel result error: %v", err)
+	}
+	if result.Code != 200 {
+		_ = conn.Close()
+		return nil, fmt.Errorf("%d %s", result.Code, result.Msg)
+	}
+	t.mux = io.NewMux(conn)
+	return t.mux, nil
+}
+
+// open 打开一个流, 连接已经断开时重新连接一次
+func (t *tunnelMux) open() (*io.Stream, error) {
+	mux, err := t.connect()
+	if err != nil {
+		return nil, err
+	}
+	stream, err := mux.Open()
+	if err == nil {
+		return stream, nil
+	}
+
+	t.lock.Lock()
+	if t.mux == mux {
+		t.mux = nil
+	}
+	t.lock.Unlock()
+	if mux, err = t.connect(); err != nil {
+		return nil, err
+	}
+	return mux.Open()
+}
+
+func serveTunnel(t *tunnelMux, listener net.Listener, port int, errs chan<- error) {
+	for {
+		local, err := listener.Accept()
+		if err != nil {
+			errs <- err
+			return
+		}
+		go tunnelConn(t, local, port)
+	}
+}
+
+func tunnelConn(t *tunnelMux, local net.Conn, port int) {
+	defer func() { _ = local.Close() }()
+
+	remote, err := t.open()
+	if err != nil {
+		common.PrintError("tunnel connect server error", err)
+		return
+	}
+	defer func() { _ = remote.Close() }()
+
+	// 流上先发送转发的端口, 服务端连接成功后返回结果
+	request := common.Request{Port: port}
+	if err = io.SendMessage(remote, &request); err != nil {
+		common.PrintError("send tunnel request error", err)
+		return
+	}
+	result := common.Result{}
+	if err = io.ReadMessage(remote, &result); err != nil {
+		common.PrintError("read tunnel result error", err)
+		return
+	}
+	if result.Code != 200 {
+		fmt.Println("tunnel error:", result.Code, result.Msg)
+		return
+	}
+
+	fmt.Println("tunnel connected", local.RemoteAddr(), "->", local.LocalAddr())
+	common.Pipe(local, remote)
+	fmt.Println("tunnel disconnected", local.RemoteAddr())
+}
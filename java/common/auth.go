@@ -0,0 +1,114 @@
+package common
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	goio "io"
+	"regexp"
+	"remote-debug/common/io"
+)
+
+const (
+	nonceLen = 32
+	// 认证前的消息只有 nonce, mac 和用户名, 不需要按照 io.MaxMessageSize 接收
+	authMessageSize = 4 << 10
+)
+
+type Challenge struct {
+	Nonce []byte `json:"Nonce"`
+}
+
+type ChallengeResponse struct {
+	Mac   []byte `json:"Mac"`
+	Nonce []byte `json:"Nonce"`
+	User  string `json:"User"`
+}
+
+var userNameRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// Authenticate 服务端校验客户端是否知道密钥, 校验通过后再向客户端证明自己也知道密钥,
+// 返回客户端的用户名, 配置了用户密钥时用户名由密钥确定, 否则使用客户端声明的用户名
+func Authenticate(conn goio.ReadWriter, key []byte, userKeys map[string][]byte) (string, error) {
+	// 发送挑战
+	nonce, err := newNonce()
+	if err != nil {
+		return "", err
+	}
+	if err = io.SendMessage(conn, &Challenge{Nonce: nonce}); err != nil {
+		return "", err
+	}
+
+	// 校验客户端的应答
+	response := ChallengeResponse{}
+	if err = io.ReadMessageLimit(conn, &response, authMessageSize); err != nil {
+		return "", err
+	}
+	if !userNameRegexp.MatchString(response.User) {
+		_ = io.SendMessage(conn, &Result{Code: 401, Msg: "authentication failed"})
+		return "", fmt.Errorf("user name error: %q", response.User)
+	}
+	if userKey, exist := userKeys[response.User]; exist {
+		key = userKey
+	}
+	if len(key) == 0 || len(response.Nonce) != nonceLen ||
+		!hmac.Equal(response.Mac, sign(key, "client", nonce, []byte(response.User))) {
+		_ = io.SendMessage(conn, &Result{Code: 401, Msg: "authentication failed"})
+		return "", fmt.Errorf("authentication failed: %s", response.User)
+	}
+
+	// 返回服务端的证明
+	return response.User, io.SendMessage(conn, &Result{Code: 200, Msg: hex.EncodeToString(sign(key, "server", response.Nonce))})
+}
+
+// Handshake 客户端以 user 的身份应答服务端的挑战, 并校验服务端是否知道密钥
+func Handshake(conn goio.ReadWriter, key []byte, user string) error {
+	challenge := Challenge{}
+	if err := io.ReadMessage(conn, &challenge); err != nil {
+		return err
+	}
+	if len(challenge.Nonce) != nonceLen {
+		return fmt.Errorf("challenge nonce len error: %d", len(challenge.Nonce))
+	}
+
+	nonce, err := newNonce()
+	if err != nil {
+		return err
+	}
+	if err = io.SendMessage(conn, &ChallengeResponse{Mac: sign(key, "client", challenge.Nonce, []byte(user)), Nonce: nonce, User: user}); err != nil {
+		return err
+	}
+
+	result := Result{}
+	if err = io.ReadMessage(conn, &result); err != nil {
+		return err
+	}
+	if result.Code != 200 {
+		return fmt.Errorf("%d %s", result.Code, result.Msg)
+	}
+	if mac, err := hex.DecodeString(result.Msg); err != nil || !hmac.Equal(mac, sign(key, "server", nonce)) {
+		return fmt.Errorf("server authentication failed")
+	}
+	return nil
+}
+
+func newNonce() ([]byte, error) {
+	nonce := make([]byte, nonceLen)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return nonce, nil
+}
+
+// 加上角色前缀, 避免服务端的证明被当成客户端的应答重放
+func sign(key []byte, role string, nonce []byte, extra ...[]byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(role))
+	mac.Write(nonce)
+	for _, data := range extra {
+		mac.Write(data)
+	}
+	return mac.Sum(nil)
+}
@@ -6,6 +6,9 @@ import (
 	"io"
 	"os"
 	"os/exec"
+	"os/user"
+	"regexp"
+	"strings"
 )
 
 type osType int8
@@ -19,12 +22,23 @@ const (
 var (
 	OsType osType
 
-	Java  string
-	Javac string
-	Mvn   string
+	Java   string
+	Javac  string
+	Mvn    string
+	Gradle string
 
 	HomePath            string
 	MavenRepositoryPath string
+
+	AuthKey []byte
+	// 服务端: 每个用户的密钥, 用户名由密钥确定
+	UserKeys = make(map[string][]byte)
+	// 客户端: 用户名, 同名项目按用户隔离
+	User string
+
+	key         string
+	keyFile     string
+	userKeyFile string
 )
 
 func init() {
@@ -40,11 +54,13 @@ func init() {
 		Java = "/usr/bin/java"
 		Javac = "/usr/bin/javac"
 		Mvn = "/usr/bin/mvn"
+		Gradle = "/usr/bin/gradle"
 		HomePath = os.Getenv("HOME")
 	} else if OsType == Window {
 		Java = fmt.Sprintf("%s/bin/java.exe", os.Getenv("JAVA_HOME"))
 		Javac = fmt.Sprintf("%s/bin/javac.exe", os.Getenv("JAVA_HOME"))
 		Mvn = fmt.Sprintf("%s/bin/mvn", os.Getenv("MAVEN_HOME"))
+		Gradle = fmt.Sprintf("%s/bin/gradle", os.Getenv("GRADLE_HOME"))
 		HomePath = fmt.Sprintf("%s%s", os.Getenv("HOMEDRIVE"), os.Getenv("HOMEPATH"))
 	} else {
 		Exit(fmt.Sprintf("os type error: %v", OsType), nil)
@@ -55,9 +71,15 @@ func init() {
 	flag.StringVar(&Java, "java", Java, "java.exe path")
 	flag.StringVar(&Javac, "javac", Javac, "javac.exe path")
 	flag.StringVar(&Mvn, "mvn", Mvn, "mvn path")
+	flag.StringVar(&Gradle, "gradle", Gradle, "gradle path")
 
 	flag.StringVar(&MavenRepositoryPath, "r", MavenRepositoryPath,
 		"repository path: C:\\Users\\Lee\\.m2\\repository")
+
+	flag.StringVar(&key, "key", os.Getenv("REMOTE_DEBUG_KEY"), "pre-shared auth key, default env REMOTE_DEBUG_KEY")
+	flag.StringVar(&keyFile, "key-file", "", "pre-shared auth key file")
+	flag.StringVar(&userKeyFile, "user-key-file", "", "server: per user auth key file, one user=key per line")
+	flag.StringVar(&User, "user", currentUser(), "client: user name, projects are isolated by user")
 }
 
 func VerifyParam() {
@@ -75,52 +97,147 @@ func VerifyParam() {
 		Exit("no find javac.exe", err)
 	}
 
-	// 判断 mvn 是否存在
-	if Mvn == "" {
-		Exit("place input MAVEN_HOME path param: -maven <mvn path>", nil)
+	// 判断 mvn 和 gradle 是否存在, 至少需要一个
+	mvnExist := Mvn != ""
+	if mvnExist {
+		_, err := os.Stat(Mvn)
+		mvnExist = err == nil
 	}
-	if _, err := os.Stat(Mvn); err != nil {
-		Exit("no find mvn", err)
+	gradleExist := Gradle != ""
+	if gradleExist {
+		_, err := os.Stat(Gradle)
+		gradleExist = err == nil
+	}
+	if !mvnExist && !gradleExist {
+		Exit("no find mvn or gradle, place input param: -mvn <mvn path> or -gradle <gradle path>", nil)
 	}
 
 	// 判断 maven 仓库是否存在
-	if MavenRepositoryPath == "" {
-		Exit("place input repository path param: -r <repository path>", nil)
+	if mvnExist {
+		if MavenRepositoryPath == "" {
+			Exit("place input repository path param: -r <repository path>", nil)
+		}
+		if _, err := os.Stat(MavenRepositoryPath); err != nil {
+			Exit("repository path error", err)
+		}
+	}
+
+	// 读取认证密钥
+	if keyFile != "" {
+		data, err := os.ReadFile(keyFile)
+		if err != nil {
+			Exit("read key file error", err)
+		}
+		key = strings.TrimSpace(string(data))
 	}
-	if _, err := os.Stat(MavenRepositoryPath); err != nil {
-		Exit("repository path error", err)
+	if userKeyFile != "" {
+		data, err := os.ReadFile(userKeyFile)
+		if err != nil {
+			Exit("read user key file error", err)
+		}
+		for _, row := range strings.Split(string(data), "\n") {
+			row = strings.TrimSpace(row)
+			if row == "" || strings.HasPrefix(row, "#") {
+				continue
+			}
+			user, userKey, ok := strings.Cut(row, "=")
+			if !ok || strings.TrimSpace(user) == "" || strings.TrimSpace(userKey) == "" {
+				Exit(fmt.Sprintf("user key file format error: %s", row), nil)
+			}
+			UserKeys[strings.TrimSpace(user)] = []byte(strings.TrimSpace(userKey))
+		}
+	}
+	if key == "" && len(UserKeys) == 0 {
+		Exit("place input auth key param: -key <key> or -key-file <key file> or env REMOTE_DEBUG_KEY", nil)
 	}
+	AuthKey = []byte(key)
 }
 
-func RunCommand(path, dir string, args []string) (string, error) {
-	cmd := &exec.Cmd{
-		Path: path,
-		Args: args,
-		Dir:  dir,
+// currentUser 获取当前系统用户名, windows 下去掉域名
+func currentUser() string {
+	name := ""
+	if current, err := user.Current(); err == nil {
+		name = current.Username
+	}
+	if name == "" {
+		name = os.Getenv("USER")
 	}
-	pipe, err := cmd.StdoutPipe()
+	if name == "" {
+		name = os.Getenv("USERNAME")
+	}
+	if i := strings.LastIndex(name, "\\"); i >= 0 {
+		name = name[i+1:]
+	}
+	return name
+}
+
+// RunCommandOutput 执行命令并返回 stdout 和 stderr 的全部输出, out 不为空时同时实时写入 out
+func RunCommandOutput(path, dir string, args []string, out io.Writer) (string, error) {
+	reader, writer, err := os.Pipe()
 	if err != nil {
 		return "", fmt.Errorf("pipe error: %s", err.Error())
 	}
-	defer func() { _ = pipe.Close() }()
-	if err := cmd.Start(); err != nil {
+	defer func() { _ = reader.Close() }()
+	cmd := &exec.Cmd{
+		Path:   path,
+		Args:   args,
+		Dir:    dir,
+		Stdout: writer,
+		Stderr: writer,
+	}
+	err = cmd.Start()
+	// 子进程已经持有写端, 关闭后子进程退出时才能读到 EOF
+	_ = writer.Close()
+	if err != nil {
 		return "", fmt.Errorf("start error: %s", err.Error())
 	}
 	result := make([]byte, 0)
 	buf := make([]byte, 64*1024)
 	for {
-		readLen, err := pipe.Read(buf)
+		readLen, err := reader.Read(buf)
+		if readLen > 0 {
+			result = append(result, buf[:readLen]...)
+			if out != nil {
+				_, _ = out.Write(buf[:readLen])
+			}
+		}
 		if err != nil {
 			if err == io.EOF {
 				break
 			}
+			_ = cmd.Wait()
 			return "", fmt.Errorf("read error: %s", err.Error())
 		}
-		result = append(result, buf[:readLen]...)
 	}
+	// 通过输出内容判断是否成功, 这里只负责回收子进程
+	_ = cmd.Wait()
 	return string(result), nil
 }
 
+// ProjectName 取项目路径的最后一级作为项目名, 同时兼容 / 和 \ 分隔符
+func ProjectName(projectPath string) string {
+	projectPath = strings.TrimRight(projectPath, "/\\")
+	i1 := strings.LastIndex(projectPath, "/")
+	i2 := strings.LastIndex(projectPath, "\\")
+
+	if i1 > i2 {
+		return projectPath[i1+1:]
+	} else {
+		return projectPath[i2+1:]
+	}
+}
+
+// projectNameRegexp 项目名会作为目录名和日志文件名, 不能包含路径分隔符, 也不能是 . 或 ..
+var projectNameRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,127}$`)
+
+// VerifyProjectName 校验项目名, 非法时返回错误
+func VerifyProjectName(name string) error {
+	if !projectNameRegexp.MatchString(name) {
+		return fmt.Errorf("project name must match %s: %q", projectNameRegexp, name)
+	}
+	return nil
+}
+
 func Exit(msg string, err error) {
 	PrintError(msg, err)
 	os.Exit(1)
@@ -0,0 +1,39 @@
+package common
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVerifyProjectName(t *testing.T) {
+	tests := []struct {
+		name string
+		ok   bool
+	}{
+		{"remote-debug-test", true},
+		{"app_1.0", true},
+		{"A", true},
+		{strings.Repeat("a", 128), true},
+		{strings.Repeat("a", 129), false},
+		{"", false},
+		{".", false},
+		{"..", false},
+		{".hidden", false},
+		{"-flag", false},
+		{"a/b", false},
+		{"../b", false},
+		{"a\\b", false},
+		{"..\\b", false},
+		{"/abs", false},
+		{"C:", false},
+		{"a b", false},
+		{"a\x00b", false},
+		{"a\nb", false},
+	}
+	for _, test := range tests {
+		err := VerifyProjectName(test.name)
+		if (err == nil) != test.ok {
+			t.Errorf("VerifyProjectName(%q) error = %v, want ok %v", test.name, err, test.ok)
+		}
+	}
+}
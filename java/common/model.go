@@ -1,15 +1,209 @@
 package common
 
+import (
+	"fmt"
+	"remote-debug/common/utils"
+)
+
+const (
+	RequestDeploy  = "deploy"
+	RequestStop    = "stop"
+	RequestRestart = "restart"
+	RequestStatus  = "status"
+	RequestLogs    = "logs"
+	RequestList    = "list"
+	// 认证后在连接上复用多个流, 每个流转发到项目的调试端口或者项目进程监听的端口
+	RequestTunnel = "tunnel"
+	// 和 deploy 一样上传编译, 通过 JDWP 替换变化的类, 不能替换时重启
+	RequestHotswap = "hotswap"
+)
+
+// Request 每个连接认证后发送的第一条消息, 服务端根据 Type 分发
+type Request struct {
+	Type    string `json:"Type"`
+	Project string `json:"Project"`
+
+	// logs 和 deploy 使用, 持续输出新日志直到客户端断开
+	Follow bool `json:"Follow"`
+	// 只输出最后 Tail 行, 小于 0 代表全部
+	Tail int `json:"Tail"`
+	// 只输出这个时间 (unix 毫秒) 之后的日志
+	Since int64 `json:"Since"`
+	// tunnel 每个流的第一条消息, 转发的端口只能是项目进程监听的端口, 0 代表调试端口
+	Port int `json:"Port"`
+}
+
+const (
+	ScopeRuntime = "runtime"
+	ScopeTest    = "test"
+)
+
+const (
+	RestartNever     = "never"
+	RestartOnFailure = "on-failure"
+	RestartAlways    = "always"
+)
+
+const (
+	StateRunning = "running"
+	// 等待自动重启
+	StateBackoff = "backoff"
+	StateExited  = "exited"
+	// on-failure 重试次数用完
+	StateFailed  = "failed"
+	StateStopped = "stopped"
+)
+
 type ProjectInfo struct {
 	ProjectPath string `json:"ProjectPath"`
 	ModulePath  string `json:"ModulePath"`
 	RunClass    string `json:"RunClass"`
-	Params      string `json:"Params"`
+	// 旧版客户端的启动参数, 服务端按照 shell 规则拆分后放在 JvmOptions 前面
+	Params string `json:"Params"`
+	// JVM 参数, 比如 -Xmx512m
+	JvmOptions []string `json:"JvmOptions"`
+	// 系统属性, 转换成 -Dkey=value
+	SystemProperties map[string]string `json:"SystemProperties"`
+	// 启动类后面的程序参数
+	ProgramArgs []string `json:"ProgramArgs"`
+	// 进程的环境变量, 覆盖服务端的同名变量
+	Env map[string]string `json:"Env"`
+	// 不继承服务端的环境变量, 只保留 EnvAllowlist 中的变量
+	CleanEnv bool `json:"CleanEnv"`
+	// 变量名, 以 * 结尾时按前缀匹配, 比如 LC_*
+	EnvAllowlist []string `json:"EnvAllowlist"`
+	// 服务端分配调试端口并添加 JDWP 参数
+	Debug bool `json:"Debug"`
+	// 启动后等待调试器连接, 对应 suspend=y
+	DebugSuspend bool `json:"DebugSuspend"`
+	// maven 或 gradle, 为空时服务端根据构建文件自动识别
+	BuildTool string `json:"BuildTool"`
+	// 依赖范围, runtime 或 test, 为空时使用 runtime
+	Scope string `json:"Scope"`
+	// 重启策略: never, on-failure, always
+	RestartPolicy string `json:"RestartPolicy"`
+	// on-failure 最多重启次数, 0 代表不限制
+	MaxRetries int `json:"MaxRetries"`
+	// 停止时等待进程退出的秒数, 超时后发送 SIGKILL, 0 使用服务端默认值
+	StopTimeout int `json:"StopTimeout"`
+	// 停止前在项目目录执行的命令, 比如通知服务下线
+	PreStop string `json:"PreStop"`
 
 	ZipTime int `json:"ZipTime"`
 }
 
+// Manifest 客户端项目的文件清单
+type Manifest struct {
+	Files []utils.FileEntry `json:"Files"`
+}
+
+// SyncPlan 服务端根据清单计算出需要上传的文件
+type SyncPlan struct {
+	Need []string `json:"Need"`
+}
+
+// ExitInfo 进程退出信息, 被信号杀死时 Code 为 -1, 等待进程失败时 Error 为等待的错误
+type ExitInfo struct {
+	Code   int    `json:"Code"`
+	Signal string `json:"Signal"`
+	Error  string `json:"Error"`
+	Time   int64  `json:"Time"`
+}
+
+// Describe 退出信息的描述
+func (exit *ExitInfo) Describe() string {
+	if exit.Error != "" {
+		return fmt.Sprintf("wait error: %s", exit.Error)
+	}
+	if exit.Code == -1 && exit.Signal == "" {
+		// 服务端重启后接管的进程拿不到退出码
+		return "exited, exit code unknown"
+	}
+	if exit.Signal != "" {
+		return fmt.Sprintf("killed by signal: %s", exit.Signal)
+	}
+	return fmt.Sprintf("exited with code %d", exit.Code)
+}
+
+// StopInfo 停止进程的过程, Killed 代表等待超时后被 SIGKILL 强制杀死
+type StopInfo struct {
+	Pid          int       `json:"Pid"`
+	PreStopError string    `json:"PreStopError"`
+	Killed       bool      `json:"Killed"`
+	Exit         *ExitInfo `json:"Exit"`
+}
+
+// Describe 停止结果的描述, 服务端和客户端打印的内容一致
+func (info *StopInfo) Describe() string {
+	if info.Exit == nil {
+		return "stopped"
+	}
+	msg := fmt.Sprintf("pid %d %s", info.Pid, info.Exit.Describe())
+	if info.Killed {
+		msg += " (SIGKILL after stop timeout)"
+	}
+	if info.PreStopError != "" {
+		msg += fmt.Sprintf(", pre stop error: %s", info.PreStopError)
+	}
+	return msg
+}
+
+// HotswapInfo 热替换的结果, Swapped 为 false 时已经重启进程, Reason 是不能热替换的原因
+type HotswapInfo struct {
+	Swapped bool     `json:"Swapped"`
+	Classes []string `json:"Classes"`
+	Reason  string   `json:"Reason"`
+}
+
+type ProcessStatus struct {
+	User      string `json:"User"`
+	Project   string `json:"Project"`
+	Pid       int    `json:"Pid"`
+	Alive     bool   `json:"Alive"`
+	State     string `json:"State"`
+	StartTime int64  `json:"StartTime"`
+	Uptime    int64  `json:"Uptime"`
+	// JDWP 端口, 0 代表没有开启调试
+	DebugPort int `json:"DebugPort"`
+
+	RestartPolicy string    `json:"RestartPolicy"`
+	Restarts      int       `json:"Restarts"`
+	CrashLoop     bool      `json:"CrashLoop"`
+	LastExit      *ExitInfo `json:"LastExit"`
+}
+
+// Output 日志等持续输出的内容, End 为 true 代表输出结束
+type Output struct {
+	Data []byte `json:"Data"`
+	End  bool   `json:"End"`
+}
+
+// CompileError 编译错误, File 是相对于项目根目录的路径
+type CompileError struct {
+	File    string `json:"File"`
+	Line    int    `json:"Line"`
+	Column  int    `json:"Column"`
+	Message string `json:"Message"`
+}
+
+// BuildFailure 构建失败的摘要
+type BuildFailure struct {
+	Module string         `json:"Module"`
+	Phase  string         `json:"Phase"`
+	Goal   string         `json:"Goal"`
+	Errors []CompileError `json:"Errors"`
+}
+
 type Result struct {
 	Code int    `json:"Code"`
 	Msg  string `json:"Msg"`
+
+	Processes []ProcessStatus `json:"Processes,omitempty"`
+	Build     *BuildFailure   `json:"Build,omitempty"`
+	Stop      *StopInfo       `json:"Stop,omitempty"`
+	Hotswap   *HotswapInfo    `json:"Hotswap,omitempty"`
+
+	// deploy 和 restart 返回启动的进程
+	Pid       int `json:"Pid,omitempty"`
+	DebugPort int `json:"DebugPort,omitempty"`
 }
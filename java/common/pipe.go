@@ -0,0 +1,28 @@
+package common
+
+import (
+	goio "io"
+	"net"
+)
+
+// Pipe 双向复制两个连接的数据, 一个方向结束后关闭对端的写, 两个方向都结束后关闭连接
+func Pipe(a, b net.Conn) {
+	done := make(chan struct{}, 2)
+	go pipeCopy(a, b, done)
+	go pipeCopy(b, a, done)
+	<-done
+	<-done
+	_ = a.Close()
+	_ = b.Close()
+}
+
+func pipeCopy(dst, src net.Conn, done chan<- struct{}) {
+	_, _ = goio.Copy(dst, src)
+	// TCP 和 TLS 连接都支持半关闭, 其他连接直接关闭
+	if conn, ok := dst.(interface{ CloseWrite() error }); ok {
+		_ = conn.CloseWrite()
+	} else {
+		_ = dst.Close()
+	}
+	done <- struct{}{}
+}
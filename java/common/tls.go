@@ -0,0 +1,101 @@
+package common
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+)
+
+var (
+	tlsEnable     bool
+	tlsCert       string
+	tlsKey        string
+	tlsCa         string
+	tlsServerName string
+)
+
+func init() {
+	flag.BoolVar(&tlsEnable, "tls", false, "client: use tls with system root ca")
+	flag.StringVar(&tlsCert, "tls-cert", "", "tls certificate file, server certificate or client certificate")
+	flag.StringVar(&tlsKey, "tls-key", "", "tls private key file")
+	flag.StringVar(&tlsCa, "tls-ca", "", "server: require client certificate signed by this ca, client: verify server with this ca")
+	flag.StringVar(&tlsServerName, "tls-server-name", "", "client: server name to verify, default host of server address")
+}
+
+// Listen 配置了证书则监听 TLS, 否则监听明文 TCP
+func Listen(addr string) (net.Listener, error) {
+	if tlsCert == "" && tlsKey == "" {
+		return net.Listen("tcp", addr)
+	}
+
+	cert, err := tls.LoadX509KeyPair(tlsCert, tlsKey)
+	if err != nil {
+		return nil, fmt.Errorf("load tls key pair error: %s", err.Error())
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	// 配置了 ca 则要求客户端证书
+	if tlsCa != "" {
+		pool, err := loadCa(tlsCa)
+		if err != nil {
+			return nil, err
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tls.Listen("tcp", addr, config)
+}
+
+// Dial 配置了 TLS 参数则使用 TLS 连接, 否则使用明文 TCP
+func Dial(addr string) (net.Conn, error) {
+	if !tlsEnable && tlsCa == "" && tlsCert == "" {
+		return net.Dial("tcp", addr)
+	}
+
+	config := &tls.Config{
+		ServerName: tlsServerName,
+		MinVersion: tls.VersionTLS12,
+	}
+	if config.ServerName == "" {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		config.ServerName = host
+	}
+	if tlsCa != "" {
+		pool, err := loadCa(tlsCa)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = pool
+	}
+
+	// 双向认证时需要客户端证书
+	if tlsCert != "" || tlsKey != "" {
+		cert, err := tls.LoadX509KeyPair(tlsCert, tlsKey)
+		if err != nil {
+			return nil, fmt.Errorf("load tls key pair error: %s", err.Error())
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return tls.Dial("tcp", addr, config)
+}
+
+func loadCa(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read tls ca error: %s", err.Error())
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificate in tls ca: %s", path)
+	}
+	return pool, nil
+}
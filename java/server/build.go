@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"remote-debug/java/common"
+	"strings"
+)
+
+// buildTool 构建工具, 编译模块并返回运行需要的 classpath
+type buildTool interface {
+	name() string
+	// build 编译模块, 构建输出实时写入 output, 返回的 classpath 包含模块自己的编译输出
+	build(info *common.ProjectInfo, output io.Writer) ([]string, error)
+}
+
+var buildTools = map[string]buildTool{
+	"maven":  maven{},
+	"gradle": gradle{},
+}
+
+// detectBuildTool 客户端指定了构建工具则直接使用, 否则先看模块目录再看项目根目录下的构建文件
+func detectBuildTool(projectPath, modulePath, toolName string) (buildTool, error) {
+	if toolName != "" {
+		if tool, ok := buildTools[toolName]; ok {
+			return tool, nil
+		}
+		return nil, fmt.Errorf("unknown build tool: %s", toolName)
+	}
+
+	for _, dir := range []string{fmt.Sprintf("%s/%s", projectPath, modulePath), projectPath} {
+		if fileExist(fmt.Sprintf("%s/pom.xml", dir)) {
+			return buildTools["maven"], nil
+		}
+		for _, name := range []string{"build.gradle", "build.gradle.kts", "settings.gradle", "settings.gradle.kts"} {
+			if fileExist(fmt.Sprintf("%s/%s", dir, name)) {
+				return buildTools["gradle"], nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("no find pom.xml or build.gradle in project")
+}
+
+func fileExist(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// buildError 构建失败, 带有从构建输出中解析出的摘要
+type buildError struct {
+	tool    string
+	failure *common.BuildFailure
+}
+
+func (e *buildError) Error() string {
+	if e.failure.Module != "" {
+		return fmt.Sprintf("%s %s error on module %s", e.tool, e.failure.Phase, e.failure.Module)
+	}
+	return fmt.Sprintf("%s %s error", e.tool, e.failure.Phase)
+}
+
+func newBuildError(tool string, failure *common.BuildFailure) *buildError {
+	return &buildError{tool: tool, failure: failure}
+}
+
+// relativePath 把服务端的绝对路径转成相对于项目根目录的路径, 客户端再拼上本地的项目路径
+func relativePath(projectPath, path string) string {
+	prefix := fmt.Sprintf("%s/", projectPath)
+	if strings.HasPrefix(path, prefix) {
+		return path[len(prefix):]
+	}
+	return path
+}
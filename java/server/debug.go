@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+var (
+	// 分配调试端口的范围
+	debugPorts   = "5005-5104"
+	debugMinPort int
+	debugMaxPort int
+	// JDWP 监听的地址, 默认只监听本机, 通过 tunnel 连接,
+	// JDWP 没有认证并且可以执行任意代码, * 代表所有网卡, 需要显式指定
+	debugHost = "127.0.0.1"
+
+	// 已经分配的调试端口, processMutex 保护
+	debugPortMap = make(map[int]*debugPortOwner)
+)
+
+type debugPortOwner struct {
+	key projectKey
+	// 使用端口的进程, 为 nil 代表正在启动
+	process *process
+}
+
+// inUse 正在启动, 运行或者等待重启的进程占用端口, 调用方需要持有 processMutex
+func (owner *debugPortOwner) inUse() bool {
+	return owner.process == nil || !owner.process.exited()
+}
+
+// parseDebugPorts 解析 -debug-ports, 格式 5005-5104 或者单个端口
+func parseDebugPorts() error {
+	minPort, maxPort, found := strings.Cut(debugPorts, "-")
+	if !found {
+		maxPort = minPort
+	}
+	var err error
+	if debugMinPort, err = strconv.Atoi(strings.TrimSpace(minPort)); err != nil {
+		return fmt.Errorf("debug ports error: %s", debugPorts)
+	}
+	if debugMaxPort, err = strconv.Atoi(strings.TrimSpace(maxPort)); err != nil {
+		return fmt.Errorf("debug ports error: %s", debugPorts)
+	}
+	if debugMinPort <= 0 || debugMaxPort > 65535 || debugMinPort > debugMaxPort {
+		return fmt.Errorf("debug ports error: %s", debugPorts)
+	}
+	return nil
+}
+
+// allocateDebugPort 为项目分配一个空闲的调试端口, 优先使用项目上次的端口, 方便调试器不用修改配置
+func allocateDebugPort(key projectKey) (int, error) {
+	processMutex.Lock()
+	defer processMutex.Unlock()
+
+	// 项目上次的端口, 旧进程在部署前已经停止
+	oldPort := 0
+	for port, owner := range debugPortMap {
+		if owner.key == key {
+			oldPort = port
+			delete(debugPortMap, port)
+		}
+	}
+	if oldPort >= debugMinPort && oldPort <= debugMaxPort && portAvailable(oldPort) {
+		debugPortMap[oldPort] = &debugPortOwner{key: key}
+		return oldPort, nil
+	}
+
+	for port := debugMinPort; port <= debugMaxPort; port++ {
+		if owner, exist := debugPortMap[port]; exist && owner.inUse() {
+			continue
+		}
+		if !portAvailable(port) {
+			continue
+		}
+		debugPortMap[port] = &debugPortOwner{key: key}
+		return port, nil
+	}
+	return 0, fmt.Errorf("no free debug port in %s", debugPorts)
+}
+
+// releaseDebugPort 启动失败时释放端口
+func releaseDebugPort(key projectKey, port int) {
+	processMutex.Lock()
+	defer processMutex.Unlock()
+	if owner, exist := debugPortMap[port]; exist && owner.key == key {
+		delete(debugPortMap, port)
+	}
+}
+
+// reserveDebugPort 重启时在停止旧进程前把端口标记为正在启动, 旧进程退出后其他项目不能分配这个端口,
+// 旧进程已经退出并且端口被其他项目分配时返回错误
+func reserveDebugPort(key projectKey, port int) error {
+	if port == 0 {
+		return nil
+	}
+	processMutex.Lock()
+	defer processMutex.Unlock()
+	if owner, exist := debugPortMap[port]; exist && owner.key != key && owner.inUse() {
+		return fmt.Errorf("debug port %d is used by %s", port, owner.key)
+	}
+	debugPortMap[port] = &debugPortOwner{key: key}
+	return nil
+}
+
+// bindDebugPort 进程启动后登记端口的使用者, 调用方需要持有 processMutex
+func bindDebugPort(p *process) {
+	if p.debugPort != 0 {
+		debugPortMap[p.debugPort] = &debugPortOwner{key: p.key, process: p}
+	}
+}
+
+// portAvailable 端口可以监听则说明没有被其他程序占用
+func portAvailable(port int) bool {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return false
+	}
+	_ = listener.Close()
+	return true
+}
+
+// loopbackHost 是否只能从本机连接
+func loopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// debugOption JDWP 参数, suspend 为 true 时启动后等待调试器连接
+func debugOption(port int, suspend bool) string {
+	suspendOption := "n"
+	if suspend {
+		suspendOption = "y"
+	}
+	address := strconv.Itoa(port)
+	if debugHost != "" {
+		address = fmt.Sprintf("%s:%d", debugHost, port)
+	}
+	return fmt.Sprintf("-agentlib:jdwp=transport=dt_socket,server=y,suspend=%s,address=%s", suspendOption, address)
+}
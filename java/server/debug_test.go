@@ -0,0 +1,33 @@
+package main
+
+import "testing"
+
+func TestReserveDebugPort(t *testing.T) {
+	minPort, maxPort := debugMinPort, debugMaxPort
+	debugMinPort, debugMaxPort = 45005, 45006
+	defer func() {
+		debugMinPort, debugMaxPort = minPort, maxPort
+		debugPortMap = make(map[int]*debugPortOwner)
+	}()
+
+	restarted := projectKey{user: "test", project: "restart"}
+	other := projectKey{user: "test", project: "other"}
+	// 旧进程已经退出, 重启前占用端口
+	old := &process{key: restarted, debugPort: 45005, done: make(chan struct{})}
+	close(old.done)
+	debugPortMap[45005] = &debugPortOwner{key: restarted, process: old}
+	if err := reserveDebugPort(restarted, 45005); err != nil {
+		t.Fatal(err)
+	}
+
+	port, err := allocateDebugPort(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if port == 45005 {
+		t.Fatal("reserved debug port allocated to another project")
+	}
+	if err = reserveDebugPort(restarted, port); err == nil {
+		t.Fatalf("debug port %d of another project reserved", port)
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"remote-debug/java/common"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 通过 init 脚本给所有 java 项目注册一个输出运行时 classpath 的任务,
+// runtimeClasspath 包含 build/classes/java/main 和 build/resources/main 以及所有依赖, test 范围使用 test 的 sourceSet
+const gradleInitScript = `allprojects {
+    plugins.withId('java') {
+        tasks.register('remoteDebugClasspath') {
+            def sourceSet = project.findProperty('remoteDebugScope') == 'test' ? project.sourceSets.test : project.sourceSets.main
+            def runtimeClasspath = sourceSet.runtimeClasspath
+            dependsOn runtimeClasspath
+            doLast {
+                file(project.property('remoteDebugClasspathFile')).text = runtimeClasspath.files.join('\n')
+            }
+        }
+    }
+}
+`
+
+var (
+	// /path/to/Main.java:12: error: cannot find symbol
+	gradleJavacErrorRegexp = regexp.MustCompile(`^(.+\.java):(\d+): error: (.*)$`)
+	// e: file:///path/to/Main.kt:12:5 Unresolved reference: foo
+	gradleKotlinErrorRegexp = regexp.MustCompile(`^e: (?:file://)?(.+\.kts?):(\d+):(\d+) (.*)$`)
+	// 紧跟在 javac 错误后面的提示信息
+	gradleJavacDetailRegexp = regexp.MustCompile(`^\s+(symbol|location|required|found|reason):`)
+	// Execution failed for task ':service:app:compileJava'.
+	gradleFailedTaskRegexp = regexp.MustCompile(`Execution failed for task '(:?(?:(.*):)?(\w+))'`)
+)
+
+// gradle 任务对应的 maven 生命周期阶段, 方便客户端统一展示
+var gradleTaskPhase = map[string]string{
+	"compileJava":          "compile",
+	"compileKotlin":        "compile",
+	"compileGroovy":        "compile",
+	"compileTestJava":      "test-compile",
+	"testClasses":          "test-compile",
+	"processResources":     "process-resources",
+	"classes":              "compile",
+	"jar":                  "package",
+	"remoteDebugClasspath": "dependency",
+}
+
+var (
+	gradleInitOnce  sync.Once
+	gradleInitPath  string
+	gradleInitError error
+)
+
+type gradle struct{}
+
+// writeGradleInitScript 只写入一次 init 脚本, 避免并行构建时同时写同一个文件
+func writeGradleInitScript() (string, error) {
+	gradleInitOnce.Do(func() {
+		initDir := fmt.Sprintf("%s/remote-debug/gradle", common.HomePath)
+		_ = os.MkdirAll(initDir, 0777)
+		gradleInitPath = fmt.Sprintf("%s/remote-debug-init.gradle", initDir)
+		gradleInitError = os.WriteFile(gradleInitPath, []byte(gradleInitScript), 0666)
+	})
+	return gradleInitPath, gradleInitError
+}
+
+func (gradle) name() string {
+	return "gradle"
+}
+
+func (gradle) build(info *common.ProjectInfo, output io.Writer) ([]string, error) {
+	projectPath, modulePath := info.ProjectPath, info.ModulePath
+
+	initScript, err := writeGradleInitScript()
+	if err != nil {
+		return nil, err
+	}
+
+	// 模块路径转成 gradle 的项目路径: service/app -> :service:app:
+	taskPrefix := ":"
+	if modulePath != "" && modulePath != "." {
+		taskPrefix = fmt.Sprintf(":%s:", strings.ReplaceAll(strings.Trim(modulePath, "/"), "/", ":"))
+	}
+	classpathFile := fmt.Sprintf("%s/%s/build/remote-debug-classpath.txt", projectPath, modulePath)
+	_ = os.Remove(classpathFile)
+
+	classesTask, scope := "classes", common.ScopeRuntime
+	if info.Scope == common.ScopeTest {
+		classesTask, scope = "testClasses", common.ScopeTest
+	}
+
+	// 编译模块并输出运行时 classpath
+	startTime := time.Now()
+	cmdResult, err := common.RunCommandOutput(common.Gradle, projectPath, []string{"gradle", "--console=plain",
+		"-I", initScript, fmt.Sprintf("-PremoteDebugClasspathFile=%s", classpathFile), fmt.Sprintf("-PremoteDebugScope=%s", scope),
+		taskPrefix + classesTask, taskPrefix + "remoteDebugClasspath"}, output)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.Contains(cmdResult, "BUILD SUCCESSFUL") {
+		return nil, newBuildError("gradle", parseGradleFailure(projectPath, cmdResult))
+	}
+	endTime := time.Now()
+	fmt.Printf("gradle exec classes time: %dms\n", endTime.UnixMilli()-startTime.UnixMilli())
+
+	data, err := os.ReadFile(classpathFile)
+	if err != nil {
+		return nil, fmt.Errorf("no find gradle classpath file: %s", err.Error())
+	}
+	classpath := make([]string, 0)
+	for _, row := range strings.Split(string(data), "\n") {
+		if row = strings.TrimSpace(row); row != "" {
+			classpath = append(classpath, row)
+		}
+	}
+	return classpath, nil
+}
+
+// parseGradleFailure 从 gradle 输出中解析失败的模块, 任务和编译错误
+func parseGradleFailure(projectPath, output string) *common.BuildFailure {
+	failure := &common.BuildFailure{Phase: "build", Errors: make([]common.CompileError, 0)}
+
+	rows := strings.Split(strings.ReplaceAll(output, "\r\n", "\n"), "\n")
+	for i := 0; i < len(rows); i++ {
+		row := rows[i]
+		if match := gradleJavacErrorRegexp.FindStringSubmatch(row); match != nil {
+			line, _ := strconv.Atoi(match[2])
+			compileError := common.CompileError{File: relativePath(projectPath, match[1]), Line: line, Message: match[3]}
+
+			// javac 会先输出源码和 ^ 标记, 再输出 symbol 等提示信息
+			for j := i + 1; j < len(rows) && j <= i+6; j++ {
+				if gradleJavacErrorRegexp.MatchString(rows[j]) {
+					break
+				}
+				if gradleJavacDetailRegexp.MatchString(rows[j]) {
+					compileError.Message += "\n" + rows[j]
+				}
+			}
+			failure.Errors = append(failure.Errors, compileError)
+			continue
+		}
+		if match := gradleKotlinErrorRegexp.FindStringSubmatch(row); match != nil {
+			line, _ := strconv.Atoi(match[2])
+			column, _ := strconv.Atoi(match[3])
+			failure.Errors = append(failure.Errors, common.CompileError{File: relativePath(projectPath, match[1]), Line: line, Column: column, Message: match[4]})
+			continue
+		}
+		if match := gradleFailedTaskRegexp.FindStringSubmatch(row); match != nil && failure.Module == "" {
+			failure.Goal = match[1]
+			failure.Module = match[2]
+			if failure.Module == "" {
+				failure.Module = ":"
+			}
+			if taskPhase, ok := gradleTaskPhase[match[3]]; ok {
+				failure.Phase = taskPhase
+			} else {
+				failure.Phase = match[3]
+			}
+		}
+	}
+	return failure
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"reflect"
+	"remote-debug/java/common"
+	"testing"
+)
+
+func TestParseGradleFailure(t *testing.T) {
+	output := `> Task :core:compileJava UP-TO-DATE
+> Task :service:app:compileJava FAILED
+/home/test/proj/service/app/src/main/java/a/Main.java:12: error: cannot find symbol
+        foo();
+        ^
+  symbol:   method foo()
+  location: class Main
+/home/test/proj/service/app/src/main/java/a/Util.java:3: error: ';' expected
+    int a = 1
+             ^
+2 errors
+
+FAILURE: Build failed with an exception.
+
+* What went wrong:
+Execution failed for task ':service:app:compileJava'.
+> Compilation failed; see the compiler error output for details.
+
+* Try:
+> Run with --stacktrace option to get the stack trace.
+
+BUILD FAILED in 2s
+1 actionable task: 1 executed
+`
+	want := &common.BuildFailure{
+		Module: "service:app",
+		Phase:  "compile",
+		Goal:   ":service:app:compileJava",
+		Errors: []common.CompileError{
+			{File: "service/app/src/main/java/a/Main.java", Line: 12, Message: "cannot find symbol\n  symbol:   method foo()\n  location: class Main"},
+			{File: "service/app/src/main/java/a/Util.java", Line: 3, Message: "';' expected"},
+		},
+	}
+	if got := parseGradleFailure("/home/test/proj", output); !reflect.DeepEqual(got, want) {
+		t.Fatalf("parseGradleFailure = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseGradleKotlinFailure(t *testing.T) {
+	output := "> Task :compileKotlin FAILED\r\n" +
+		"e: file:///home/test/proj/src/main/kotlin/a/Main.kt:5:13 Unresolved reference: foo\r\n" +
+		"\r\n" +
+		"FAILURE: Build failed with an exception.\r\n" +
+		"\r\n" +
+		"* What went wrong:\r\n" +
+		"Execution failed for task ':compileKotlin'.\r\n" +
+		"> Compilation error. See log for more details\r\n"
+	want := &common.BuildFailure{
+		Module: ":",
+		Phase:  "compile",
+		Goal:   ":compileKotlin",
+		Errors: []common.CompileError{
+			{File: "src/main/kotlin/a/Main.kt", Line: 5, Column: 13, Message: "Unresolved reference: foo"},
+		},
+	}
+	if got := parseGradleFailure("/home/test/proj", output); !reflect.DeepEqual(got, want) {
+		t.Fatalf("parseGradleFailure = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"remote-debug/common/io"
+	"remote-debug/java/common"
+	"sort"
+	"strconv"
+)
+
+func handleStop(conn net.Conn, key projectKey) {
+	unlock := lockProject(key)
+	defer unlock()
+
+	if _, exist := getProcess(key); !exist {
+		_ = io.SendMessage(conn, common.Result{Code: 404, Msg: fmt.Sprintf("no find project: %s", key)})
+		return
+	}
+	info := stopProject(key)
+	if info == nil {
+		_ = io.SendMessage(conn, common.Result{Code: 200, Msg: "not running"})
+		return
+	}
+	_ = io.SendMessage(conn, common.Result{Code: 200, Msg: info.Describe(), Stop: info})
+}
+
+// handleRestart 使用上次部署的启动参数重新启动项目, 不重新编译
+func handleRestart(conn net.Conn, key projectKey, request common.Request) {
+	unlock := lockProject(key)
+	old, exist := getProcess(key)
+	if !exist {
+		unlock()
+		_ = io.SendMessage(conn, common.Result{Code: 404, Msg: fmt.Sprintf("no find project: %s", key)})
+		return
+	}
+	// 启动参数中的调试端口不能变, 停止前先占用, 避免其他项目部署时分配
+	if err := reserveDebugPort(key, old.debugPort); err != nil {
+		unlock()
+		_ = io.SendMessage(conn, common.Result{Code: 500, Msg: err.Error()})
+		return
+	}
+	stopped := stopProject(key)
+	if stopped != nil {
+		fmt.Println(key, stopped.Describe())
+	}
+
+	p, err := runProject(old.key, old.dir, old.args, old.env, old.policy, old.stopOptions, old.debugPort)
+	if err != nil {
+		releaseDebugPort(key, old.debugPort)
+	}
+	unlock()
+	if err != nil {
+		_ = io.SendMessage(conn, common.Result{Code: 500, Msg: err.Error(), Stop: stopped})
+		return
+	}
+	fmt.Println("restart process success", p.pid())
+	result := common.Result{Code: 200, Msg: strconv.Itoa(p.pid()), Pid: p.pid(), DebugPort: p.debugPort, Stop: stopped}
+	if err = io.SendMessage(conn, result); err == nil && request.Follow {
+		attachProcess(conn, p)
+	}
+}
+
+func handleStatus(conn net.Conn, key projectKey) {
+	p, exist := getProcess(key)
+	if !exist {
+		_ = io.SendMessage(conn, common.Result{Code: 404, Msg: fmt.Sprintf("no find project: %s", key)})
+		return
+	}
+	_ = io.SendMessage(conn, common.Result{Code: 200, Processes: []common.ProcessStatus{processStatus(p)}})
+}
+
+func handleList(conn net.Conn) {
+	processList := listProcess()
+	processes := make([]common.ProcessStatus, 0, len(processList))
+	for _, p := range processList {
+		processes = append(processes, processStatus(p))
+	}
+	sort.Slice(processes, func(i, j int) bool {
+		if processes[i].User != processes[j].User {
+			return processes[i].User < processes[j].User
+		}
+		return processes[i].Project < processes[j].Project
+	})
+	_ = io.SendMessage(conn, common.Result{Code: 200, Processes: processes})
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"remote-debug/common/utils"
+	"remote-debug/java/common"
+	"sort"
+	"strings"
+)
+
+// classFile classpath 目录中的 class 文件
+type classFile struct {
+	path string
+	hash string
+}
+
+// snapshotClasses 计算 classpath 中所有目录下 class 文件的 hash, key 是类名 a/b/Main$Inner
+func snapshotClasses(classpath []string) map[string]classFile {
+	classes := make(map[string]classFile)
+	for _, dir := range classpath {
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			continue
+		}
+		_ = filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil || entry.IsDir() || !strings.HasSuffix(path, ".class") {
+				return nil
+			}
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return nil
+			}
+			name := strings.TrimSuffix(filepath.ToSlash(rel), ".class")
+			// 和类加载器一样, 多个目录中有同名的类时使用 classpath 中靠前的
+			if _, exist := classes[name]; exist {
+				return nil
+			}
+			hash, err := utils.HashFile(path)
+			if err != nil {
+				return nil
+			}
+			classes[name] = classFile{path: path, hash: hash}
+			return nil
+		})
+	}
+	return classes
+}
+
+// changedClasses 编译前后内容发生变化的类, 新增的类不需要替换, 使用时会从磁盘加载
+func changedClasses(before, after map[string]classFile) []string {
+	changed := make([]string, 0)
+	for name, file := range after {
+		if old, exist := before[name]; exist && old.hash != file.hash {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// processClasspath 从启动参数中找到 classpath
+func processClasspath(args []string) []string {
+	for i, arg := range args {
+		if arg == "-classpath" && i+1 < len(args) {
+			return strings.Split(args[i+1], string(os.PathListSeparator))
+		}
+	}
+	return nil
+}
+
+// hotswapTarget 判断正在运行的进程能不能热替换, 不能时返回原因
+func hotswapTarget(key projectKey, args []string, env environment, policy restartPolicy, stopOptions stopOptions) (*process, string) {
+	p, exist := getProcess(key)
+	if !exist || !processStatus(p).Alive {
+		return nil, "project is not running"
+	}
+	if p.debugPort == 0 {
+		return nil, "project is not started with -debug"
+	}
+	// 启动参数, classpath 和环境变量变化后只能重启
+	if !reflect.DeepEqual(p.args, args) || !reflect.DeepEqual(p.env, env) ||
+		p.policy != policy || p.stopOptions != stopOptions {
+		return nil, "launch options or dependencies changed"
+	}
+	return p, ""
+}
+
+// errCannotRedefine 虚拟机不支持重新定义类
+var errCannotRedefine = errors.New("jvm can not redefine classes")
+
+// unsupportedChange 修改不能热替换, 需要重启进程, 连接 JDWP 失败 (比如 IDE 正在调试) 等其他错误不能重启
+func unsupportedChange(err error) bool {
+	var jdwpErr *jdwpError
+	if errors.As(err, &jdwpErr) {
+		return jdwpUnsupportedChanges[jdwpErr.code]
+	}
+	return errors.Is(err, errCannotRedefine)
+}
+
+// hotswap 通过 JDWP 重新定义变化的类, unsupportedChange 的错误需要重启进程
+func hotswap(p *process, before, after map[string]classFile) (*common.HotswapInfo, error) {
+	changed := changedClasses(before, after)
+	info := &common.HotswapInfo{Swapped: true, Classes: make([]string, 0, len(changed))}
+	if len(changed) == 0 {
+		return info, nil
+	}
+
+	conn, err := dialJdwp(debugDialAddr(p.debugPort))
+	if err != nil {
+		return nil, fmt.Errorf("connect jdwp error: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	canRedefine, err := conn.canRedefineClasses()
+	if err != nil {
+		return nil, err
+	}
+	if !canRedefine {
+		return nil, errCannotRedefine
+	}
+
+	classes := make([]jdwpClass, 0, len(changed))
+	for _, name := range changed {
+		typeIDs, err := conn.classesBySignature(fmt.Sprintf("L%s;", name))
+		if err != nil {
+			return nil, err
+		}
+		// 还没有加载的类不需要替换
+		if len(typeIDs) == 0 {
+			continue
+		}
+		data, err := os.ReadFile(after[name].path)
+		if err != nil {
+			return nil, err
+		}
+		for _, typeID := range typeIDs {
+			classes = append(classes, jdwpClass{typeID: typeID, data: data})
+		}
+		info.Classes = append(info.Classes, strings.ReplaceAll(name, "/", "."))
+	}
+	if len(classes) == 0 {
+		return info, nil
+	}
+
+	if err = conn.redefineClasses(classes); err != nil {
+		return nil, fmt.Errorf("redefine classes error: %w", err)
+	}
+	return info, nil
+}
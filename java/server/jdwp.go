@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	goio "io"
+	"net"
+	"time"
+)
+
+// JDWP 协议: https://docs.oracle.com/javase/8/docs/platform/jpda/jdwp/jdwp-protocol.html
+// 只实现热替换需要的命令
+
+const (
+	jdwpHandshake = "JDWP-Handshake"
+	// 包头: length(4) id(4) flags(1), 命令包后面是 commandSet(1) command(1), 回复包后面是 errorCode(2)
+	jdwpHeaderLength = 11
+	jdwpReplyFlag    = 0x80
+
+	jdwpVirtualMachine         = 1
+	jdwpClassesBySignature     = 2
+	jdwpDispose                = 6
+	jdwpIDSizes                = 7
+	jdwpCapabilitiesNew        = 17
+	jdwpRedefineClasses        = 18
+	jdwpCanRedefineClassesFlag = 7
+
+	jdwpTimeout = time.Minute
+)
+
+// jdwpErrorNames RedefineClasses 可能返回的错误
+var jdwpErrorNames = map[uint16]string{
+	21:  "INVALID_CLASS",
+	60:  "INVALID_CLASS_FORMAT",
+	61:  "CIRCULAR_CLASS_DEFINITION",
+	62:  "FAILS_VERIFICATION",
+	63:  "ADD_METHOD_NOT_IMPLEMENTED",
+	64:  "SCHEMA_CHANGE_NOT_IMPLEMENTED",
+	65:  "INVALID_TYPESTATE",
+	66:  "HIERARCHY_CHANGE_NOT_IMPLEMENTED",
+	67:  "DELETE_METHOD_NOT_IMPLEMENTED",
+	68:  "UNSUPPORTED_VERSION",
+	69:  "NAMES_DONT_MATCH",
+	70:  "CLASS_MODIFIERS_CHANGE_NOT_IMPLEMENTED",
+	71:  "METHOD_MODIFIERS_CHANGE_NOT_IMPLEMENTED",
+	72:  "CLASS_ATTRIBUTE_CHANGE_NOT_IMPLEMENTED",
+	99:  "NOT_IMPLEMENTED",
+	112: "VM_DEAD",
+}
+
+// jdwpUnsupportedChanges RedefineClasses 不支持的修改, 比如修改字段或者增删方法, 只能重启进程
+var jdwpUnsupportedChanges = map[uint16]bool{
+	63: true, // ADD_METHOD_NOT_IMPLEMENTED
+	64: true, // SCHEMA_CHANGE_NOT_IMPLEMENTED
+	66: true, // HIERARCHY_CHANGE_NOT_IMPLEMENTED
+	67: true, // DELETE_METHOD_NOT_IMPLEMENTED
+	70: true, // CLASS_MODIFIERS_CHANGE_NOT_IMPLEMENTED
+	71: true, // METHOD_MODIFIERS_CHANGE_NOT_IMPLEMENTED
+	72: true, // CLASS_ATTRIBUTE_CHANGE_NOT_IMPLEMENTED
+	99: true, // NOT_IMPLEMENTED
+}
+
+type jdwpError struct {
+	code uint16
+}
+
+func (e *jdwpError) Error() string {
+	if name, exist := jdwpErrorNames[e.code]; exist {
+		return fmt.Sprintf("jdwp error %d %s", e.code, name)
+	}
+	return fmt.Sprintf("jdwp error %d", e.code)
+}
+
+// jdwpClass 需要重新定义的类, typeID 按照虚拟机返回的长度原样保存
+type jdwpClass struct {
+	typeID []byte
+	data   []byte
+}
+
+type jdwpConn struct {
+	conn net.Conn
+	id   uint32
+	// referenceTypeID 的长度, 由 IDSizes 返回
+	referenceTypeIDSize int
+}
+
+// dialJdwp 连接虚拟机的调试端口并完成握手, 同一时间虚拟机只接受一个调试器连接
+func dialJdwp(addr string) (*jdwpConn, error) {
+	conn, err := net.DialTimeout("tcp", addr, 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Now().Add(jdwpTimeout))
+
+	c := &jdwpConn{conn: conn}
+	if err = c.handshake(); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	if err = c.idSizes(); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *jdwpConn) handshake() error {
+	if _, err := c.conn.Write([]byte(jdwpHandshake)); err != nil {
+		return err
+	}
+	reply := make([]byte, len(jdwpHandshake))
+	if _, err := goio.ReadFull(c.conn, reply); err != nil {
+		return fmt.Errorf("jdwp handshake error, is another debugger attached? %v", err)
+	}
+	if string(reply) != jdwpHandshake {
+		return fmt.Errorf("jdwp handshake error: %q", reply)
+	}
+	return nil
+}
+
+// Close 先发送 Dispose 让虚拟机恢复调试器挂起的线程
+func (c *jdwpConn) Close() error {
+	_, _ = c.command(jdwpVirtualMachine, jdwpDispose, nil)
+	return c.conn.Close()
+}
+
+// command 发送命令并等待对应的回复, 虚拟机主动发送的事件包直接丢弃
+func (c *jdwpConn) command(commandSet, command byte, data []byte) ([]byte, error) {
+	c.id++
+	packet := make([]byte, jdwpHeaderLength, jdwpHeaderLength+len(data))
+	binary.BigEndian.PutUint32(packet[0:4], uint32(jdwpHeaderLength+len(data)))
+	binary.BigEndian.PutUint32(packet[4:8], c.id)
+	packet[9] = commandSet
+	packet[10] = command
+	packet = append(packet, data...)
+	if _, err := c.conn.Write(packet); err != nil {
+		return nil, err
+	}
+
+	for {
+		header := make([]byte, jdwpHeaderLength)
+		if _, err := goio.ReadFull(c.conn, header); err != nil {
+			return nil, err
+		}
+		length := binary.BigEndian.Uint32(header[0:4])
+		if length < jdwpHeaderLength {
+			return nil, fmt.Errorf("jdwp packet length error: %d", length)
+		}
+		body := make([]byte, length-jdwpHeaderLength)
+		if _, err := goio.ReadFull(c.conn, body); err != nil {
+			return nil, err
+		}
+		if header[8]&jdwpReplyFlag == 0 || binary.BigEndian.Uint32(header[4:8]) != c.id {
+			continue
+		}
+		if errorCode := binary.BigEndian.Uint16(header[9:11]); errorCode != 0 {
+			return nil, &jdwpError{code: errorCode}
+		}
+		return body, nil
+	}
+}
+
+// idSizes 读取各种 id 的长度, 只用到 referenceTypeID
+func (c *jdwpConn) idSizes() error {
+	reply, err := c.command(jdwpVirtualMachine, jdwpIDSizes, nil)
+	if err != nil {
+		return err
+	}
+	// fieldID, methodID, objectID, referenceTypeID, frameID
+	if len(reply) < 20 {
+		return fmt.Errorf("jdwp id sizes reply error")
+	}
+	c.referenceTypeIDSize = int(binary.BigEndian.Uint32(reply[12:16]))
+	if c.referenceTypeIDSize <= 0 || c.referenceTypeIDSize > 8 {
+		return fmt.Errorf("jdwp reference type id size error: %d", c.referenceTypeIDSize)
+	}
+	return nil
+}
+
+func (c *jdwpConn) canRedefineClasses() (bool, error) {
+	reply, err := c.command(jdwpVirtualMachine, jdwpCapabilitiesNew, nil)
+	if err != nil {
+		return false, err
+	}
+	if len(reply) <= jdwpCanRedefineClassesFlag {
+		return false, fmt.Errorf("jdwp capabilities reply error")
+	}
+	return reply[jdwpCanRedefineClassesFlag] != 0, nil
+}
+
+// classesBySignature 返回已经加载的类, 不同的类加载器可能加载了多个同名的类, 还没加载的类返回空
+func (c *jdwpConn) classesBySignature(signature string) ([][]byte, error) {
+	data := make([]byte, 4, 4+len(signature))
+	binary.BigEndian.PutUint32(data, uint32(len(signature)))
+	data = append(data, signature...)
+	reply, err := c.command(jdwpVirtualMachine, jdwpClassesBySignature, data)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := bytes.NewReader(reply)
+	var count uint32
+	if err = binary.Read(reader, binary.BigEndian, &count); err != nil {
+		return nil, err
+	}
+	typeIDs := make([][]byte, 0, count)
+	for i := uint32(0); i < count; i++ {
+		// refTypeTag(1) typeID status(4)
+		entry := make([]byte, 1+c.referenceTypeIDSize+4)
+		if _, err = goio.ReadFull(reader, entry); err != nil {
+			return nil, err
+		}
+		typeIDs = append(typeIDs, entry[1:1+c.referenceTypeIDSize])
+	}
+	return typeIDs, nil
+}
+
+// redefineClasses 一次重新定义所有的类, 虚拟机保证要么全部成功要么全部失败
+func (c *jdwpConn) redefineClasses(classes []jdwpClass) error {
+	var data bytes.Buffer
+	_ = binary.Write(&data, binary.BigEndian, uint32(len(classes)))
+	for _, class := range classes {
+		data.Write(class.typeID)
+		_ = binary.Write(&data, binary.BigEndian, uint32(len(class.data)))
+		data.Write(class.data)
+	}
+	_, err := c.command(jdwpVirtualMachine, jdwpRedefineClasses, data.Bytes())
+	return err
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"remote-debug/common/utils"
+	"remote-debug/java/common"
+	"sort"
+	"strings"
+)
+
+// javaArgs 生成启动命令: java [JVM 参数] [调试参数] [系统属性] -classpath <classpath> <启动类> [程序参数]
+func javaArgs(info *common.ProjectInfo, classpath string, debugPort int) ([]string, error) {
+	args := []string{common.Java, "-Dfile.encoding=UTF-8"}
+
+	// 兼容旧版客户端
+	if info.Params != "" {
+		params, err := utils.SplitArgs(info.Params)
+		if err != nil {
+			return nil, fmt.Errorf("params error: %v", err)
+		}
+		args = append(args, params...)
+	}
+	for _, option := range info.JvmOptions {
+		if !strings.HasPrefix(option, "-") {
+			return nil, fmt.Errorf("jvm option must start with -: %s", option)
+		}
+		args = append(args, option)
+	}
+	if debugPort != 0 {
+		// 两个 JDWP agent 会抢同一个参数, 手动指定时不能再使用 --debug
+		for _, arg := range args {
+			if strings.HasPrefix(arg, "-agentlib:jdwp") || strings.HasPrefix(arg, "-Xrunjdwp") {
+				return nil, fmt.Errorf("--debug conflicts with jvm option: %s", arg)
+			}
+		}
+		args = append(args, debugOption(debugPort, info.DebugSuspend))
+	}
+
+	// map 无序, 排序后每次启动的参数都一样
+	keys := make([]string, 0, len(info.SystemProperties))
+	for key := range info.SystemProperties {
+		if key == "" || strings.Contains(key, "=") {
+			return nil, fmt.Errorf("system property name error: %q", key)
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		args = append(args, fmt.Sprintf("-D%s=%s", key, info.SystemProperties[key]))
+	}
+
+	args = append(args, "-classpath", classpath, info.RunClass)
+	return append(args, info.ProgramArgs...), nil
+}
+
+// environment 进程的环境变量, 不保存服务端的环境变量, 每次启动时重新读取
+type environment struct {
+	// 项目的环境变量, KEY=VALUE
+	vars []string
+	// 不继承服务端的环境变量, 只保留 allowlist 中的变量
+	clean     bool
+	allowlist []string
+}
+
+func newEnvironment(info *common.ProjectInfo) (environment, error) {
+	keys := make([]string, 0, len(info.Env))
+	for key := range info.Env {
+		if key == "" || strings.ContainsAny(key, "=\x00") {
+			return environment{}, fmt.Errorf("env name error: %q", key)
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, name := range info.EnvAllowlist {
+		if name == "" || name == "*" || strings.ContainsAny(name, "=\x00") {
+			return environment{}, fmt.Errorf("env allowlist error: %q", name)
+		}
+	}
+
+	env := environment{vars: make([]string, 0, len(keys)), clean: info.CleanEnv, allowlist: info.EnvAllowlist}
+	for _, key := range keys {
+		env.vars = append(env.vars, fmt.Sprintf("%s=%s", key, info.Env[key]))
+	}
+	return env, nil
+}
+
+// environ 启动进程使用的环境变量, 项目的变量放在后面, 同名时覆盖服务端的变量
+func (env environment) environ() []string {
+	if !env.clean {
+		return append(os.Environ(), env.vars...)
+	}
+	environ := make([]string, 0, len(env.allowlist)+len(env.vars))
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		if env.allowed(name) {
+			environ = append(environ, kv)
+		}
+	}
+	return append(environ, env.vars...)
+}
+
+func (env environment) allowed(name string) bool {
+	for _, pattern := range env.allowlist {
+		if strings.HasSuffix(pattern, "*") {
+			if strings.HasPrefix(name, strings.TrimSuffix(pattern, "*")) {
+				return true
+			}
+		} else if name == pattern {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	goio "io"
+	"net"
+	"remote-debug/common/utils"
+	"remote-debug/java/common"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// 一次部署解压后的总大小, 也是清单中所有文件的总大小
+	maxUploadSize int64 = 4 << 30
+	maxFiles            = 100000
+	maxFileSize   int64 = 1 << 30
+
+	// 超过限制后最多再丢弃的数据, 客户端写完之后才会读取 413, 超过时直接断开
+	maxDiscardSize int64 = 64 << 20
+	discardTimeout       = 30 * time.Second
+)
+
+// sizeFlag 字节数参数, 支持 K, M, G 后缀
+type sizeFlag int64
+
+func (f *sizeFlag) String() string {
+	if f == nil {
+		return "0"
+	}
+	return strconv.FormatInt(int64(*f), 10)
+}
+
+func (f *sizeFlag) Set(value string) error {
+	size, err := parseSize(value)
+	if err != nil {
+		return err
+	}
+	*f = sizeFlag(size)
+	return nil
+}
+
+// parseSize 解析 512, 64K, 16M, 4G 这样的大小
+func parseSize(value string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(value))
+	unit := int64(1)
+	switch {
+	case strings.HasSuffix(s, "K"):
+		unit = 1 << 10
+	case strings.HasSuffix(s, "M"):
+		unit = 1 << 20
+	case strings.HasSuffix(s, "G"):
+		unit = 1 << 30
+	}
+	if unit != 1 {
+		s = s[:len(s)-1]
+	}
+	size, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || size <= 0 || size > (1<<62)/unit {
+		return 0, fmt.Errorf("size error: %s", value)
+	}
+	return size * unit, nil
+}
+
+// checkManifest 按照清单中声明的大小提前拒绝部署, 不需要等到上传完成, 实际大小在解压时校验
+func checkManifest(files []utils.FileEntry) error {
+	if len(files) > maxFiles {
+		return &utils.LimitError{What: "file count", Size: int64(len(files)), Limit: int64(maxFiles)}
+	}
+	var total int64
+	for _, entry := range files {
+		if entry.Size > maxFileSize {
+			return &utils.LimitError{What: fmt.Sprintf("file %s size", entry.Path), Size: entry.Size, Limit: maxFileSize}
+		}
+		total += entry.Size
+	}
+	if total > maxUploadSize {
+		return &utils.LimitError{What: "project size", Size: total, Limit: maxUploadSize}
+	}
+	return nil
+}
+
+// uploadSizeLimit 上传的 tar.gz 最大的大小, gzip 无法压缩的数据会略微变大, 每个文件还有文件头和对齐
+func uploadSizeLimit(files []utils.FileEntry, need []string) int64 {
+	sizes := make(map[string]int64, len(files))
+	for _, entry := range files {
+		sizes[entry.Path] = entry.Size + int64(len(entry.Link))
+	}
+	limit := int64(1 << 10)
+	for _, path := range need {
+		limit += sizes[path] + sizes[path]/256 + 2048 + 2*int64(len(path))
+	}
+	return limit
+}
+
+func archiveLimits() utils.ArchiveLimits {
+	return utils.ArchiveLimits{MaxFiles: maxFiles, MaxFileSize: maxFileSize, MaxTotalSize: maxUploadSize}
+}
+
+// discardMessage 消息超过长度限制时还没有读取消息内容, 丢弃后客户端才能收到错误
+func discardMessage(conn net.Conn, err error) {
+	var limitErr *utils.LimitError
+	if !errors.As(err, &limitErr) || limitErr.Size > maxDiscardSize {
+		return
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(discardTimeout))
+	_, _ = goio.CopyN(goio.Discard, conn, limitErr.Size)
+	_ = conn.SetReadDeadline(time.Time{})
+}
+
+// errorResult 超过限制返回 413, 其他错误返回 code
+func errorResult(code int, err error) common.Result {
+	if utils.IsLimitError(err) {
+		code = 413
+	}
+	return common.Result{Code: code, Msg: err.Error()}
+}
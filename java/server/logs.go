@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	goio "io"
+	"net"
+	"os"
+	"remote-debug/common/io"
+	"remote-debug/java/common"
+	"time"
+)
+
+// 日志行开头常见的时间格式, 用来支持 --since
+var logTimeLayouts = []string{
+	"2006-01-02 15:04:05.000",
+	"2006-01-02T15:04:05.000",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+}
+
+// outputWriter 把写入的内容作为 Output 发送给客户端
+type outputWriter struct {
+	conn net.Conn
+}
+
+func (w *outputWriter) Write(p []byte) (int, error) {
+	if err := io.SendMessage(w.conn, common.Output{Data: p}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+type logOptions struct {
+	// 从文件的这个位置开始读取
+	offset int64
+	// 只发送最后 tail 行, 小于 0 代表不限制
+	tail int
+	// 跳过时间早于 since 的日志
+	since time.Time
+	// 持续发送新写入的日志
+	follow bool
+	// follow 时返回 true 则发送完剩余日志后结束
+	stopFollow func() bool
+}
+
+// handleLogs 把项目的日志文件发送给客户端
+func handleLogs(conn net.Conn, key projectKey, request common.Request) {
+	path := logPath(key)
+	if _, err := os.Stat(path); err != nil {
+		if os.IsNotExist(err) {
+			_ = io.SendMessage(conn, common.Result{Code: 404, Msg: fmt.Sprintf("no find project log: %s", key)})
+		} else {
+			_ = io.SendMessage(conn, common.Result{Code: 500, Msg: err.Error()})
+		}
+		return
+	}
+	if err := io.SendMessage(conn, common.Result{Code: 200}); err != nil {
+		return
+	}
+
+	options := logOptions{tail: request.Tail, follow: request.Follow}
+	if request.Since > 0 {
+		options.since = time.UnixMilli(request.Since)
+	}
+	if err := streamLog(conn, path, options); err != nil {
+		common.PrintError("stream log error", err)
+	}
+}
+
+func streamLog(conn net.Conn, path string, options logOptions) error {
+	logFile, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = logFile.Close() }()
+
+	// 计算开始位置
+	offset := options.offset
+	if !options.since.IsZero() {
+		if offset, err = sinceOffset(logFile, offset, options.since); err != nil {
+			return err
+		}
+	}
+	if options.tail >= 0 {
+		tailOffset, err := tailOffset(logFile, options.tail)
+		if err != nil {
+			return err
+		}
+		if tailOffset > offset {
+			offset = tailOffset
+		}
+	}
+	if _, err = logFile.Seek(offset, goio.SeekStart); err != nil {
+		return err
+	}
+
+	// 客户端断开连接后停止 follow
+	closed := make(chan struct{})
+	if options.follow {
+		go func() {
+			_, _ = conn.Read(make([]byte, 1))
+			close(closed)
+		}()
+	}
+
+	buf := make([]byte, 32*1024)
+	for {
+		readLen, err := logFile.Read(buf)
+		if readLen > 0 {
+			if err := io.SendMessage(conn, common.Output{Data: buf[:readLen]}); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil && err != goio.EOF {
+			return err
+		}
+		if !options.follow || (options.stopFollow != nil && options.stopFollow()) {
+			break
+		}
+
+		// 等待新日志
+		select {
+		case <-closed:
+			return nil
+		case <-time.After(200 * time.Millisecond):
+		}
+
+		// 日志文件被截断则从头开始读
+		if fileInfo, err := logFile.Stat(); err == nil {
+			if current, err := logFile.Seek(0, goio.SeekCurrent); err == nil && fileInfo.Size() < current {
+				_, _ = logFile.Seek(0, goio.SeekStart)
+			}
+		}
+	}
+	return io.SendMessage(conn, common.Output{End: true})
+}
+
+// sinceOffset 返回第一行时间不早于 since 的日志位置, 没有时间的行跟随上一行
+func sinceOffset(logFile *os.File, offset int64, since time.Time) (int64, error) {
+	if _, err := logFile.Seek(offset, goio.SeekStart); err != nil {
+		return 0, err
+	}
+	reader := bufio.NewReader(logFile)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if lineTime, ok := parseLogTime(line); ok && !lineTime.Before(since) {
+			return offset, nil
+		}
+		offset += int64(len(line))
+		if err != nil {
+			return offset, nil
+		}
+	}
+}
+
+func parseLogTime(line []byte) (time.Time, bool) {
+	line = bytes.TrimLeft(line, "[ ")
+	for _, layout := range logTimeLayouts {
+		if len(line) < len(layout) {
+			continue
+		}
+		if lineTime, err := time.ParseInLocation(layout, string(line[:len(layout)]), time.Local); err == nil {
+			return lineTime, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// tailOffset 从文件末尾往前找, 返回最后 tail 行的开始位置
+func tailOffset(logFile *os.File, tail int) (int64, error) {
+	fileInfo, err := logFile.Stat()
+	if err != nil {
+		return 0, err
+	}
+	offset := fileInfo.Size()
+	if offset == 0 || tail == 0 {
+		return offset, nil
+	}
+
+	// 最后一个字符是换行的话不算一行
+	last := make([]byte, 1)
+	if _, err = logFile.ReadAt(last, offset-1); err != nil {
+		return 0, err
+	}
+	end := offset
+	if last[0] == '\n' {
+		end--
+	}
+
+	buf := make([]byte, 32*1024)
+	lines := 0
+	for end > 0 {
+		start := end - int64(len(buf))
+		if start < 0 {
+			start = 0
+		}
+		if _, err = logFile.ReadAt(buf[:end-start], start); err != nil {
+			return 0, err
+		}
+		for i := end - start - 1; i >= 0; i-- {
+			if buf[i] != '\n' {
+				continue
+			}
+			// 找到第 tail 个换行, 后面就是最后 tail 行
+			if lines++; lines == tail {
+				return start + i + 1, nil
+			}
+		}
+		end = start
+	}
+	return 0, nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	goio "io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTailOffset(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		tail    int
+		want    string
+	}{
+		{"tail 0", "a\nb\nc\n", 0, ""},
+		{"tail 1", "a\nb\nc\n", 1, "c\n"},
+		{"tail 2", "a\nb\nc\n", 2, "b\nc\n"},
+		{"tail all", "a\nb\nc\n", 3, "a\nb\nc\n"},
+		{"tail larger than file", "a\nb\nc\n", 10, "a\nb\nc\n"},
+		{"no trailing newline", "a\nb\nc", 1, "c"},
+		{"no trailing newline tail 2", "a\nb\nc", 2, "b\nc"},
+		{"empty file", "", 1, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "log")
+			if err := os.WriteFile(path, []byte(test.content), 0666); err != nil {
+				t.Fatal(err)
+			}
+			logFile, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = logFile.Close() }()
+
+			offset, err := tailOffset(logFile, test.tail)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err = logFile.Seek(offset, goio.SeekStart); err != nil {
+				t.Fatal(err)
+			}
+			got, err := goio.ReadAll(logFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != test.want {
+				t.Errorf("tailOffset(%q, %d) = %q, want %q", test.content, test.tail, got, test.want)
+			}
+		})
+	}
+}
+
+func TestTailOffsetLongFile(t *testing.T) {
+	// 超过一次读取的缓冲区大小
+	path := filepath.Join(t.TempDir(), "log")
+	content := make([]byte, 0, 100*1024)
+	for len(content) < 90*1024 {
+		content = append(content, "0123456789abcdef\n"...)
+	}
+	if err := os.WriteFile(path, content, 0666); err != nil {
+		t.Fatal(err)
+	}
+	logFile, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = logFile.Close() }()
+
+	offset, err := tailOffset(logFile, 3000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := int64(len(content) - 3000*17); offset != want {
+		t.Errorf("tailOffset = %d, want %d", offset, want)
+	}
+}
@@ -3,343 +3,463 @@ package main
 import (
 	"flag"
 	"fmt"
+	goio "io"
 	"net"
 	"os"
-	"os/exec"
 	"remote-debug/common/io"
 	"remote-debug/common/utils"
 	"remote-debug/java/common"
 	"strconv"
 	"strings"
-	"syscall"
 	"time"
 )
 
-type MavenDependency struct {
-	groupId    string
-	artifactId string
-	version    string
-	packaging  string
-
-	dirPath  string
-	filePath []string
-}
-
 var (
 	listenPort = 50005
+)
 
-	projectInfo = common.ProjectInfo{}
-
-	processMap = make(map[string]int)
+// session 一次部署请求的状态, 每个连接独立, 可以同时部署多个项目
+type session struct {
+	conn    net.Conn
+	request common.Request
 
+	projectInfo common.ProjectInfo
+	manifest    common.Manifest
+	projectKey  projectKey
 	projectPath string
-	projectName string
-)
+	// 上传的数据的大小限制, 根据同步计划计算
+	uploadLimit int64
+
+	// 启动参数在停止旧进程之前校验
+	policy      restartPolicy
+	stopOptions stopOptions
+	env         environment
+
+	// 部署时停止旧进程的结果, 和部署结果一起返回给客户端
+	stopped *common.StopInfo
+}
 
 func init() {
 	flag.IntVar(&listenPort, "port", listenPort, "listen port: 50005")
+	flag.StringVar(&debugPorts, "debug-ports", debugPorts, "port range allocated for --debug: 5005-5104")
+	flag.StringVar(&debugHost, "debug-host", debugHost,
+		"host the JDWP agent listens on, attach through the tunnel command by default. "+
+			"JDWP has no authentication and allows running any code, * listens on all interfaces and should only be used on a trusted network, "+
+			"empty uses the JDK default which is all interfaces on JDK 8")
+	flag.DurationVar(&stopTimeout, "stop-timeout", stopTimeout, "default time to wait for the process to exit after SIGTERM before SIGKILL")
+	flag.Var((*sizeFlag)(&io.MaxMessageSize), "max-message-size", "max size of a request message, such as the manifest: 64M")
+	flag.Var((*sizeFlag)(&maxUploadSize), "max-upload-size", "max total uncompressed size of a deploy: 4G")
+	flag.IntVar(&maxFiles, "max-files", maxFiles, "max file count of a deploy")
+	flag.Var((*sizeFlag)(&maxFileSize), "max-file-size", "max size of a single uploaded file: 1G")
+	flag.Var((*sizeFlag)(&maxDiscardSize), "max-discard-size", "max data discarded after a limit is exceeded, so the client can read the error: 64M")
+}
 
+func main() {
+	// 参数在 main 中解析, 测试时不会解析 go test 的参数
 	flag.Parse()
 
 	// 校验环境参数是否正确
 	common.VerifyParam()
-}
-
-func main() {
-	listenAddr, err := net.ResolveTCPAddr("tcp", fmt.Sprintf(":%d", listenPort))
-	if err != nil {
-		common.Exit("resolve tcp addr error", err)
+	if err := parseDebugPorts(); err != nil {
+		common.Exit("debug ports param error", err)
 	}
-	listener, err := net.ListenTCP("tcp", listenAddr)
+	if !loopbackHost(debugHost) {
+		fmt.Printf("warning: JDWP listens on %q, anyone who can reach the debug ports can run code in the projects\n", debugHost)
+	}
+
+	// 接管上次服务端启动的进程
+	restoreState()
+
+	listener, err := common.Listen(fmt.Sprintf(":%d", listenPort))
 	if err != nil {
 		common.Exit("listen tcp error", err)
 	}
 
 	fmt.Println("start server success")
 	for {
-		conn, err := listener.AcceptTCP()
+		conn, err := listener.Accept()
 		if err != nil {
 			common.Exit("accept tcp error", err)
 		}
-		go startProcess(conn)
+		go handleConn(conn)
 	}
 }
 
-func startProcess(conn *net.TCPConn) {
+func handleConn(conn net.Conn) {
 	defer func() { _ = conn.Close() }()
-	fmt.Println("new request")
+	fmt.Println("new request", conn.RemoteAddr())
 
-	// 接收参数
-	readParam(conn)
+	// 认证
+	user, err := common.Authenticate(conn, common.AuthKey, common.UserKeys)
+	if err != nil {
+		common.PrintError(fmt.Sprintf("authenticate %s error", conn.RemoteAddr()), err)
+		return
+	}
 
-	// 重新设置项目路径
-	projectName = getProjectName(projectInfo.ProjectPath)
-	projectPath = fmt.Sprintf("%s/remote-debug/%s", common.HomePath, projectName)
-	projectInfo.ProjectPath = projectPath
+	// 读取请求类型
+	request := common.Request{}
+	if err = io.ReadMessage(conn, &request); err != nil {
+		common.PrintError("read request error", err)
+		if utils.IsLimitError(err) {
+			discardMessage(conn, err)
+			_ = io.SendMessage(conn, errorResult(400, err))
+		}
+		return
+	}
+	fmt.Println("request", user, request.Type, request.Project)
+	key := projectKey{user: user, project: request.Project}
+
+	// 项目名会拼接到路径中, deploy 的项目名可以为空, 校验放在读取参数之后
+	if request.Type != common.RequestDeploy && request.Type != common.RequestHotswap && request.Type != common.RequestList {
+		if err = common.VerifyProjectName(request.Project); err != nil {
+			common.PrintError("verify request error", err)
+			_ = io.SendMessage(conn, common.Result{Code: 400, Msg: err.Error()})
+			return
+		}
+	}
 
-	// 如果有旧项目则需要先暂停
-	stopOldProject(projectName)
+	switch request.Type {
+	case common.RequestDeploy, common.RequestHotswap:
+		startProcess(conn, user, request)
+	case common.RequestStop:
+		handleStop(conn, key)
+	case common.RequestRestart:
+		handleRestart(conn, key, request)
+	case common.RequestStatus:
+		handleStatus(conn, key)
+	case common.RequestLogs:
+		handleLogs(conn, key, request)
+	case common.RequestList:
+		handleList(conn)
+	case common.RequestTunnel:
+		handleTunnel(conn, key)
+	default:
+		_ = io.SendMessage(conn, common.Result{Code: 400, Msg: fmt.Sprintf("unknown request type: %s", request.Type)})
+	}
+}
 
-	// 删除旧文件
-	_ = os.RemoveAll(projectInfo.ProjectPath)
+func startProcess(conn net.Conn, user string, request common.Request) {
+	s := &session{conn: conn, request: request}
 
-	// 下载文件
-	zipData, err := downloadZip(conn)
-	if err != nil {
-		_ = io.SendMessage(conn, common.Result{Code: 500, Msg: err.Error()})
+	// 接收参数
+	if err := s.readParam(); err != nil {
 		return
 	}
 
-	// 解压 zip
-	if err = UnZip(zipData); err != nil {
-		_ = io.SendMessage(conn, common.Result{Code: 500, Msg: err.Error()})
+	// 重新设置项目路径
+	s.projectKey = projectKey{user: user, project: request.Project}
+	if s.projectKey.project == "" {
+		s.projectKey.project = common.ProjectName(s.projectInfo.ProjectPath)
+	}
+	s.projectPath = projectDir(s.projectKey)
+	s.projectInfo.ProjectPath = s.projectPath
+
+	// 读取客户端的文件清单
+	if err := io.ReadMessage(conn, &s.manifest); err != nil {
+		common.PrintError("read manifest error", err)
+		if utils.IsLimitError(err) {
+			discardMessage(conn, err)
+			_ = io.SendMessage(conn, errorResult(400, err))
+		}
 		return
 	}
 
-	// 解析 maven依赖
-	mavenDependencyList, err := parseMavenDependency()
-	if err != nil {
-		common.PrintError("parse maven dependency error", err)
-		_ = io.SendMessage(conn, common.Result{Code: 500, Msg: err.Error()})
+	// 非法请求在返回同步计划的位置返回错误, 不影响正在运行的项目
+	if err := s.verify(); err != nil {
+		common.PrintError("verify deploy request error", err)
+		_ = io.SendMessage(conn, errorResult(400, err))
 		return
 	}
 
-	// 解析所有jar包路径
-	classpath := parseJarPath(mavenDependencyList)
-	classPath := fmt.Sprintf("%s/%s/target/classes", projectInfo.ProjectPath, projectInfo.ModulePath)
-	classpath = fmt.Sprintf("%s%c%s", classPath, os.PathListSeparator, classpath)
+	p := s.deploy()
 
-	// 创建日志文件
-	logFile, err := createLogFile()
-	if err != nil {
-		_ = io.SendMessage(conn, common.Result{Code: 500, Msg: err.Error()})
-		return
+	if p != nil && request.Follow {
+		attachProcess(conn, p)
 	}
+}
 
-	// 运行项目
-	cmd, err := runProject(classpath, logFile)
-	if err != nil {
-		_ = io.SendMessage(conn, common.Result{Code: 500, Msg: err.Error()})
-		return
+// deploy 上传并启动项目, 结果已经返回给客户端, 启动失败返回 nil
+func (s *session) deploy() *process {
+	// 同一个项目同时只能有一个部署, 不同项目可以并行构建
+	unlock := lockProject(s.projectKey)
+	defer unlock()
+
+	// 如果有旧项目则需要先暂停, 热替换编译成功后再决定是否重启
+	if s.request.Type != common.RequestHotswap {
+		s.stopOld()
 	}
-	pid := cmd.Process.Pid
 
-	// 返回结果
-	fmt.Println("start process success", pid)
-	_ = io.SendMessage(conn, common.Result{Code: 200, Msg: strconv.Itoa(pid)})
+	// 对比文件清单
+	manifest, err := s.syncManifest()
+	if err != nil {
+		_ = io.SendMessage(s.conn, common.Result{Code: 500, Msg: err.Error(), Stop: s.stopped})
+		return nil
+	}
 
-	// 等待停止项目
-	processMap[projectName] = pid
-	if _, err = cmd.Process.Wait(); err != nil {
-		fmt.Println("wait error", pid, err)
+	// 构建输出实时发送给客户端, 输出结束后再返回结果
+	p, result := s.deployProject(manifest)
+	result.Stop = s.stopped
+	_ = io.SendMessage(s.conn, common.Output{End: true})
+	if err = io.SendMessage(s.conn, result); err != nil {
+		return nil
 	}
-	fmt.Println(pid, "exit success")
+	return p
 }
 
-func readParam(conn *net.TCPConn) {
-	if err := io.ReadMessage(conn, &projectInfo); err != nil {
-		common.PrintError("read project info error", err)
-		return
+func (s *session) deployProject(manifest []utils.FileEntry) (*process, common.Result) {
+	// 接收文件, 边接收边解压
+	if err := s.receiveFiles(); err != nil {
+		return nil, errorResult(500, err)
 	}
-	fmt.Println("read project info success", projectInfo.ProjectPath, projectInfo.ModulePath, projectInfo.RunClass)
-	fmt.Printf("zip time: %dms\n", projectInfo.ZipTime)
-}
 
-func stopOldProject(projectName string) {
-	if pid, exist := processMap[projectName]; exist {
-		fmt.Println("stop old project", pid)
-		syscall.Kill(pid, 15)
-		for {
-			if err := syscall.Kill(pid, 0); err != nil {
-				break
-			}
-			time.Sleep(500 * time.Millisecond)
+	// 保存清单, 下次部署只需要上传变化的文件
+	if err := s.saveManifest(manifest); err != nil {
+		common.PrintError("save manifest error", err)
+	}
+
+	// 热替换需要对比编译前后的 class 文件
+	var before map[string]classFile
+	if s.request.Type == common.RequestHotswap {
+		if old, exist := getProcess(s.projectKey); exist {
+			before = snapshotClasses(processClasspath(old.args))
 		}
-		delete(processMap, projectName)
 	}
-}
 
-func downloadZip(conn *net.TCPConn) ([]byte, error) {
-	startTime := time.Now()
-	zipData, err := io.ReadData(conn)
+	// 编译项目并获取 classpath
+	tool, err := detectBuildTool(s.projectPath, s.projectInfo.ModulePath, s.projectInfo.BuildTool)
 	if err != nil {
-		common.PrintError("download zip data error", err)
-		// 返回错误
-		return nil, err
+		return nil, common.Result{Code: 400, Msg: err.Error()}
 	}
-	endTime := time.Now()
-	fmt.Printf("dowwnload zip time: %dms\n", endTime.UnixMilli()-startTime.UnixMilli())
-	return zipData, nil
-}
+	fmt.Println("build tool", tool.name())
+	classpathList, err := tool.build(&s.projectInfo, &outputWriter{conn: s.conn})
+	if err != nil {
+		common.PrintError(fmt.Sprintf("%s build error", tool.name()), err)
+		if buildErr, ok := err.(*buildError); ok {
+			return nil, common.Result{Code: 500, Msg: err.Error(), Build: buildErr.failure}
+		}
+		return nil, common.Result{Code: 500, Msg: err.Error()}
+	}
+	classpath := strings.Join(classpathList, string(os.PathListSeparator))
 
-func UnZip(zipData []byte) error {
-	startTime := time.Now()
-	fmt.Println("new project path", projectPath)
-	if err := utils.UnZip(zipData, projectPath); err != nil {
-		common.PrintError("un zip error", err)
-		return err
+	// 热替换成功则不需要重启
+	var hotswapInfo *common.HotswapInfo
+	if s.request.Type == common.RequestHotswap {
+		p, info, err := s.hotswap(classpathList, before)
+		if err != nil {
+			// 比如 IDE 通过 tunnel 连接了调试端口, 这时不能重启正在调试的进程
+			common.PrintError(fmt.Sprintf("%s hotswap error", s.projectKey), err)
+			return nil, common.Result{Code: 500, Msg: fmt.Sprintf("hotswap error, the running process is kept: %v", err)}
+		}
+		if info.Swapped {
+			fmt.Println(s.projectKey, "hotswap", len(info.Classes), "classes")
+			return p, common.Result{Code: 200, Msg: strconv.Itoa(p.pid()), Pid: p.pid(), DebugPort: p.debugPort, Hotswap: info}
+		}
+		fmt.Println(s.projectKey, "hotswap fallback to restart:", info.Reason)
+		hotswapInfo = info
+		s.stopOld()
 	}
-	endTime := time.Now()
-	fmt.Printf("un zip time: %dms\n", endTime.UnixMilli()-startTime.UnixMilli())
-	return nil
+
+	p, result := s.launch(classpath)
+	result.Hotswap = hotswapInfo
+	return p, result
 }
 
-func parseJarPath(mavenDependencyList []MavenDependency) string {
-	classpath := ""
-	if len(mavenDependencyList) > 0 {
-		for _, mavenDependency := range mavenDependencyList {
-			for _, jarPath := range mavenDependency.filePath {
-				classpath += fmt.Sprintf("%s/%s%c", common.MavenRepositoryPath, jarPath, os.PathListSeparator)
-			}
+// launch 启动编译好的项目
+func (s *session) launch(classpath string) (*process, common.Result) {
+	var err error
+
+	// 分配调试端口
+	debugPort := 0
+	if s.projectInfo.Debug {
+		if debugPort, err = allocateDebugPort(s.projectKey); err != nil {
+			return nil, common.Result{Code: 503, Msg: err.Error()}
 		}
 	}
-	if len(classpath) > 0 {
-		classpath = classpath[:len(classpath)-1]
-	}
-	return classpath
-}
 
-func createLogFile() (*os.File, error) {
-	_ = os.MkdirAll(fmt.Sprintf("%s/remote-debug/logs", common.HomePath), 0777)
-	logPath := fmt.Sprintf("%s/remote-debug/logs/%s.log", common.HomePath, projectName)
-	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	// 运行项目
+	args, err := javaArgs(&s.projectInfo, classpath, debugPort)
 	if err != nil {
-		common.PrintError("open log path error error", err)
-		return nil, err
+		releaseDebugPort(s.projectKey, debugPort)
+		return nil, common.Result{Code: 400, Msg: err.Error()}
+	}
+	p, err := runProject(s.projectKey, s.projectPath, args, s.env, s.policy, s.stopOptions, debugPort)
+	if err != nil {
+		releaseDebugPort(s.projectKey, debugPort)
+		return nil, common.Result{Code: 500, Msg: err.Error()}
 	}
-	return logFile, nil
+
+	// 返回结果
+	fmt.Println("start process success", p.pid(), "debug port", debugPort)
+	return p, common.Result{Code: 200, Msg: strconv.Itoa(p.pid()), Pid: p.pid(), DebugPort: debugPort}
 }
 
-func runProject(classpath string, logFile *os.File) (*exec.Cmd, error) {
-	cmd := &exec.Cmd{
-		Path:   common.Java,
-		Args:   []string{common.Java, "-Dfile.encoding=UTF-8", projectInfo.Params, "-classpath", classpath, projectInfo.RunClass}, // TODO 不知道怎么改成后台启动
-		Dir:    projectInfo.ProjectPath,
-		Stdout: logFile,
-	}
-	fmt.Println(cmd.Args)
-	if err := cmd.Start(); err != nil {
-		common.PrintError("start process error", err)
-		// 返回错误
-		return nil, err
+// stopOld 停止项目正在运行的进程
+func (s *session) stopOld() {
+	if info := stopProject(s.projectKey); info != nil {
+		fmt.Println(s.projectKey, info.Describe())
+		s.stopped = info
 	}
-	return cmd, nil
 }
 
-// 获取所有依赖
-func parseMavenDependency() ([]MavenDependency, error) {
-	mavenDependencyList := make([]MavenDependency, 0)
-	// 用来判断是否jar包是否已经添加了, 避免重复添加
-	jarExistCache := make(map[string]int8, 0)
-
-	// 编译项目的源文件 编译项目依赖的 jar包
-	startTime := time.Now()
-	cmdResult, err := common.RunCommand(common.Mvn, projectInfo.ProjectPath, []string{"mvn", "compile"})
+// hotswap 使用正在运行的进程的调试端口生成启动参数, 和旧进程一致时才能热替换,
+// 不能热替换时返回原因, 由调用方重启, 返回错误时不能重启, 进程可能正在被调试
+func (s *session) hotswap(classpathList []string, before map[string]classFile) (*process, *common.HotswapInfo, error) {
+	debugPort := 0
+	if old, exist := getProcess(s.projectKey); exist {
+		debugPort = old.debugPort
+	}
+	args, err := javaArgs(&s.projectInfo, strings.Join(classpathList, string(os.PathListSeparator)), debugPort)
 	if err != nil {
-		return nil, err
+		return nil, &common.HotswapInfo{Reason: err.Error()}, nil
 	}
-	if !strings.Contains(cmdResult, "BUILD SUCCESS") {
-		return nil, fmt.Errorf("mvn compile error: %s", cmdResult)
+	p, reason := hotswapTarget(s.projectKey, args, s.env, s.policy, s.stopOptions)
+	if p == nil {
+		return nil, &common.HotswapInfo{Reason: reason}, nil
 	}
-	endTime := time.Now()
-	fmt.Printf("mvn exec compile time: %dms\n", endTime.UnixMilli()-startTime.UnixMilli())
-	startTime = time.Now()
-	cmdResult, err = common.RunCommand(common.Mvn, projectInfo.ProjectPath, []string{"mvn", "install"})
+	info, err := hotswap(p, before, snapshotClasses(classpathList))
 	if err != nil {
-		return nil, err
+		if unsupportedChange(err) {
+			return nil, &common.HotswapInfo{Reason: err.Error()}, nil
+		}
+		return p, nil, err
 	}
-	if !strings.Contains(cmdResult, "BUILD SUCCESS") {
-		return nil, fmt.Errorf("mvn install error: %s", cmdResult)
+	return p, info, nil
+}
+
+func (s *session) readParam() error {
+	if err := io.ReadMessage(s.conn, &s.projectInfo); err != nil {
+		common.PrintError("read project info error", err)
+		// 客户端发送清单后读取同步计划时收到错误
+		if utils.IsLimitError(err) {
+			discardMessage(s.conn, err)
+			_ = io.SendMessage(s.conn, errorResult(400, err))
+		}
+		return err
 	}
-	endTime = time.Now()
-	fmt.Printf("mvn exec install time: %dms\n", endTime.UnixMilli()-startTime.UnixMilli())
+	// 兼容 windows 客户端的模块路径
+	s.projectInfo.ModulePath = strings.Trim(strings.ReplaceAll(s.projectInfo.ModulePath, "\\", "/"), "/")
+	fmt.Println("read project info success", s.projectInfo.ProjectPath, s.projectInfo.ModulePath, s.projectInfo.RunClass)
+	fmt.Printf("manifest time: %dms\n", s.projectInfo.ZipTime)
+	return nil
+}
 
-	// 获取 maven 返回的依赖列表
-	startTime = time.Now()
-	cmdResult, err = common.RunCommand(common.Mvn,
-		fmt.Sprintf("%s/%s", projectInfo.ProjectPath, projectInfo.ModulePath),
-		[]string{"mvn", "dependency:list"})
-	if err != nil {
-		return nil, err
+// verify 校验项目名, 模块路径和清单中的路径, 这些都会拼接到服务端的路径中,
+// 启动参数也在这里校验, 参数错误时不能先停止正在运行的进程
+func (s *session) verify() error {
+	if err := common.VerifyProjectName(s.projectKey.project); err != nil {
+		return err
 	}
-	if !strings.Contains(cmdResult, "BUILD SUCCESS") {
-		return nil, fmt.Errorf("mvn dependency:list error: %s", cmdResult)
+	if s.projectInfo.ModulePath != "" {
+		if err := utils.VerifyPath(s.projectInfo.ModulePath); err != nil {
+			return fmt.Errorf("module path error: %v", err)
+		}
 	}
-	endTime = time.Now()
-	fmt.Printf("mvn exec dependency:list time: %dms\n", endTime.UnixMilli()-startTime.UnixMilli())
-
-	// 分割每一行依赖项
-	rows := strings.Split(cmdResult, "\n")
-	start := false
-	for _, row := range rows {
-		// 通过这个条件判断获取依赖是否成功
-		if !start && strings.Contains(row, "The following files have been resolved:") {
-			start = true
-			continue
+	for _, entry := range s.manifest.Files {
+		if err := utils.VerifyPath(entry.Path); err != nil {
+			return fmt.Errorf("manifest error: %v", err)
 		}
-		if !start {
-			continue
+		if entry.Link != "" {
+			if err := utils.VerifyLink(entry.Path, entry.Link); err != nil {
+				return fmt.Errorf("manifest error: %v", err)
+			}
 		}
+	}
+	if err := checkManifest(s.manifest.Files); err != nil {
+		return err
+	}
 
-		// maven 返回结果会以 [INFO] 开头, 所以需要先排除日志级别
-		row = strings.TrimSpace(row[strings.Index(row, "]")+1:])
-		// 如果有一行是空的则代表已经解析完所有依赖项了
-		if len(row) == 0 {
-			break
-		}
+	var err error
+	if s.policy, err = newRestartPolicy(s.projectInfo.RestartPolicy, s.projectInfo.MaxRetries); err != nil {
+		return err
+	}
+	if s.stopOptions, err = newStopOptions(&s.projectInfo); err != nil {
+		return err
+	}
+	if s.env, err = newEnvironment(&s.projectInfo); err != nil {
+		return err
+	}
+	// 调试端口启动时才分配, 用任意非 0 的端口校验 JVM 参数和 --debug 是否冲突
+	checkPort := 0
+	if s.projectInfo.Debug {
+		checkPort = debugMinPort
+	}
+	_, err = javaArgs(&s.projectInfo, "", checkPort)
+	return err
+}
 
-		// 没有啥好办法, 只能见招拆招了
-		dependencyInfoList := strings.Split(row, ":")
-		var mavenDependency MavenDependency
-		if len(dependencyInfoList) == 5 {
-			mavenDependency = MavenDependency{groupId: dependencyInfoList[0], artifactId: dependencyInfoList[1], version: dependencyInfoList[3], packaging: dependencyInfoList[2]}
-		} else if len(dependencyInfoList) == 6 {
-			mavenDependency = MavenDependency{groupId: dependencyInfoList[0], artifactId: dependencyInfoList[1], version: dependencyInfoList[4], packaging: dependencyInfoList[2]}
-		} else {
-			return nil, fmt.Errorf("mvn dependency list dependencyInfoList len error: %s", row)
-		}
+// 对比客户端的文件清单, 返回需要上传的文件并删除客户端已经不存在的文件
+func (s *session) syncManifest() ([]utils.FileEntry, error) {
+	manifest := s.manifest
 
-		// 计算 jar包 路径, 需要把 groupId 转成文件路径
-		mavenDependency.dirPath = fmt.Sprintf("%s/%s/%s",
-			strings.ReplaceAll(mavenDependency.groupId, ".", "/"),
-			mavenDependency.artifactId, mavenDependency.version)
+	// 读取上次部署的清单, 没有的话就全量上传
+	oldManifest := common.Manifest{}
+	if data, err := os.ReadFile(s.manifestPath()); err == nil {
+		if err = io.ToObj(data, &oldManifest); err != nil {
+			common.PrintError("parse old manifest error", err)
+			oldManifest.Files = nil
+		}
+	}
 
-		// 获取此依赖项下的所有 jar包
-		mavenDependency.filePath = make([]string, 0)
-		dependencyDir, err := os.ReadDir(fmt.Sprintf("%s/%s", common.MavenRepositoryPath, mavenDependency.dirPath))
+	need, remove := utils.DiffManifest(s.projectPath, oldManifest.Files, manifest.Files)
+	s.uploadLimit = uploadSizeLimit(manifest.Files, need)
+	for _, path := range remove {
+		// 旧清单可能是之前的版本保存的, 删除前也要校验路径
+		filePath, err := utils.SafeJoin(s.projectPath, path)
+		if err == nil {
+			err = utils.VerifyRealPath(s.projectPath, filePath)
+		}
 		if err != nil {
-			return nil, fmt.Errorf("no find dependency dir: %s", err.Error())
+			common.PrintError("remove file error", err)
+			continue
 		}
-		for _, jarFileInfo := range dependencyDir {
-			if !jarFileInfo.IsDir() && strings.HasSuffix(jarFileInfo.Name(), ".jar") && !strings.HasSuffix(jarFileInfo.Name(), "-javadoc.jar") && !strings.HasSuffix(jarFileInfo.Name(), "-sources.jar") {
-				jarPath := fmt.Sprintf("%s/%s", mavenDependency.dirPath, jarFileInfo.Name())
-				// 去重
-				if _, exist := jarExistCache[jarPath]; !exist {
-					jarExistCache[jarPath] = 1
-					mavenDependency.filePath = append(mavenDependency.filePath, jarPath)
-				}
-			}
+		if err = os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+			common.PrintError("remove file error", err)
 		}
-
-		// 添加依赖项
-		mavenDependencyList = append(mavenDependencyList, mavenDependency)
 	}
+	fmt.Printf("sync manifest: %d files, need %d, remove %d\n", len(manifest.Files), len(need), len(remove))
+
+	// 清单写入磁盘前先删掉旧的, 避免上传中断后旧清单和文件对不上
+	_ = os.Remove(s.manifestPath())
 
-	// 判断 maven 获取依赖是否成功
-	if !start {
-		return nil, fmt.Errorf("mvn dependency list error: %s", cmdResult)
+	if err := io.SendMessage(s.conn, &common.SyncPlan{Need: need}); err != nil {
+		common.PrintError("send sync plan error", err)
+		return nil, err
 	}
+	return manifest.Files, nil
+}
 
-	return mavenDependencyList, nil
+func (s *session) manifestPath() string {
+	return fmt.Sprintf("%s/.remote-debug-manifest.json", s.projectPath)
 }
 
-func getProjectName(projectPath string) string {
-	i1 := strings.LastIndex(projectPath, "/")
-	i2 := strings.LastIndex(projectPath, "\\")
+func (s *session) saveManifest(manifest []utils.FileEntry) error {
+	data, err := io.ToByte(&common.Manifest{Files: manifest})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.manifestPath(), data, 0666)
+}
 
-	if i1 > i2 {
-		return projectPath[i1+1:]
+// receiveFiles 接收客户端上传的文件并直接解压到项目目录, 不在内存中缓存
+func (s *session) receiveFiles() error {
+	startTime := time.Now()
+	fmt.Println("new project path", s.projectPath)
+	chunks := io.NewChunkReader(s.conn, s.uploadLimit)
+	err := utils.ExtractArchive(chunks, s.projectPath, archiveLimits())
+	if err == nil {
+		// 读完 tar.gz 后面剩下的数据
+		_, err = goio.Copy(goio.Discard, chunks)
 	} else {
-		return projectPath[i2+1:]
+		// 客户端写完之后才会读取结果, 出错时丢弃还没读取的数据, 超过 maxDiscardSize 时直接断开
+		_ = s.conn.SetReadDeadline(time.Now().Add(discardTimeout))
+		_ = chunks.Discard(maxDiscardSize)
+		_ = s.conn.SetReadDeadline(time.Time{})
+	}
+	if err != nil {
+		common.PrintError("receive files error", err)
+		return err
 	}
+	endTime := time.Now()
+	fmt.Printf("receive files time: %dms, %d bytes\n", endTime.UnixMilli()-startTime.UnixMilli(), chunks.Total())
+	return nil
 }
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	goio "io"
+	"net"
+	"os"
+	"path/filepath"
+	"remote-debug/common/io"
+	"remote-debug/common/utils"
+	"remote-debug/java/common"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeBuild 记录每个项目同时进行的构建, 构建总是失败, 不会启动进程
+type fakeBuild struct {
+	lock    sync.Mutex
+	running map[string]int
+	// 所有项目同时进行的构建的最大数量
+	maxRunning int
+	total      int
+	overlaps   []string
+}
+
+func (b *fakeBuild) name() string {
+	return "fake"
+}
+
+func (b *fakeBuild) build(info *common.ProjectInfo, output goio.Writer) ([]string, error) {
+	b.lock.Lock()
+	b.running[info.ProjectPath]++
+	if b.running[info.ProjectPath] > 1 {
+		b.overlaps = append(b.overlaps, info.ProjectPath)
+	}
+	b.total++
+	if b.total > b.maxRunning {
+		b.maxRunning = b.total
+	}
+	b.lock.Unlock()
+
+	_, _ = fmt.Fprintln(output, "fake build", info.ProjectPath)
+	time.Sleep(50 * time.Millisecond)
+
+	b.lock.Lock()
+	b.running[info.ProjectPath]--
+	b.total--
+	b.lock.Unlock()
+	return nil, errors.New("fake build done")
+}
+
+// fakeClient 按照客户端的顺序上传同步计划需要的文件, 读取构建输出和结果
+func fakeClient(conn net.Conn, src string, manifest []utils.FileEntry) (common.Result, error) {
+	result := common.Result{}
+	plan := common.SyncPlan{}
+	if err := io.ReadMessage(conn, &plan); err != nil {
+		return result, err
+	}
+	entries := make(map[string]utils.FileEntry, len(manifest))
+	for _, entry := range manifest {
+		entries[entry.Path] = entry
+	}
+	files := make([]utils.FileEntry, 0, len(plan.Need))
+	for _, path := range plan.Need {
+		files = append(files, entries[path])
+	}
+	writer := io.NewChunkWriter(conn)
+	if err := utils.WriteArchive(writer, src, files); err != nil {
+		return result, err
+	}
+	if err := writer.Close(); err != nil {
+		return result, err
+	}
+
+	for {
+		output := common.Output{}
+		if err := io.ReadMessage(conn, &output); err != nil {
+			return result, err
+		}
+		if output.End {
+			break
+		}
+	}
+	err := io.ReadMessage(conn, &result)
+	return result, err
+}
+
+func TestConcurrentDeploy(t *testing.T) {
+	home := common.HomePath
+	common.HomePath = t.TempDir()
+	tool := &fakeBuild{running: make(map[string]int)}
+	buildTools["fake"] = tool
+	defer func() {
+		common.HomePath = home
+		delete(buildTools, "fake")
+	}()
+
+	src := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(src, "src/a"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "src/a/Main.java"), []byte("package a;\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := utils.BuildManifest(src, &utils.IgnoreFilter{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 每个项目同时部署 4 次
+	projects := []string{"p1", "p2", "p3"}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		for _, project := range projects {
+			serverConn, clientConn := net.Pipe()
+			s := &session{conn: serverConn, request: common.Request{Type: common.RequestDeploy, Project: project}}
+			s.projectKey = projectKey{user: "test", project: project}
+			s.projectPath = projectDir(s.projectKey)
+			s.projectInfo = common.ProjectInfo{ProjectPath: s.projectPath, RunClass: "a.Main", BuildTool: "fake"}
+			s.manifest = common.Manifest{Files: manifest}
+			if err = s.verify(); err != nil {
+				t.Fatal(err)
+			}
+
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				defer func() { _ = serverConn.Close() }()
+				if p := s.deploy(); p != nil {
+					t.Errorf("%s: deploy should not start a process after a failed build", s.projectKey)
+				}
+			}()
+			go func(project string) {
+				defer wg.Done()
+				defer func() { _ = clientConn.Close() }()
+				result, err := fakeClient(clientConn, src, manifest)
+				if err != nil {
+					t.Errorf("%s: client error: %v", project, err)
+					return
+				}
+				if result.Code != 500 || result.Msg != "fake build done" {
+					t.Errorf("%s: unexpected result: %d %s", project, result.Code, result.Msg)
+				}
+			}(project)
+		}
+	}
+	wg.Wait()
+
+	if len(tool.overlaps) > 0 {
+		t.Fatalf("deploys of the same project overlapped: %v", tool.overlaps)
+	}
+	if tool.maxRunning < 2 {
+		t.Fatalf("deploys of different projects should run in parallel, max running %d", tool.maxRunning)
+	}
+	for _, project := range projects {
+		path := filepath.Join(projectDir(projectKey{user: "test", project: project}), "src/a/Main.java")
+		if _, err = os.Stat(path); err != nil {
+			t.Errorf("uploaded file missing: %v", err)
+		}
+	}
+}
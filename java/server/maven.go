@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"remote-debug/java/common"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type maven struct{}
+
+func (maven) name() string {
+	return "maven"
+}
+
+// build 在项目根目录执行一次 reactor 构建, 同时编译模块和它依赖的兄弟模块, 不再 install 到本地仓库,
+// 兄弟模块直接使用上传目录中的 target/classes, 资源过滤由 process-resources 输出到 target/classes
+func (maven) build(info *common.ProjectInfo, output io.Writer) ([]string, error) {
+	scope, goal := common.ScopeRuntime, "compile"
+	if info.Scope == common.ScopeTest {
+		scope, goal = common.ScopeTest, "test-compile"
+	}
+
+	modulePath := fmt.Sprintf("%s/%s", info.ProjectPath, info.ModulePath)
+	classpathFile := fmt.Sprintf("%s/target/remote-debug-classpath.txt", modulePath)
+	_ = os.Remove(classpathFile)
+
+	// 编译项目并解析依赖, outputFile 是相对于每个模块目录的路径
+	args := []string{goal, "dependency:build-classpath",
+		"-Dmdep.outputFile=target/remote-debug-classpath.txt",
+		fmt.Sprintf("-Dmdep.includeScope=%s", scope)}
+	if info.ModulePath != "" && info.ModulePath != "." {
+		args = append([]string{"-pl", info.ModulePath, "-am"}, args...)
+	}
+	if err := runMaven(info.ProjectPath, info.ProjectPath, output, goal, args...); err != nil {
+		return nil, err
+	}
+
+	dependencyList, err := parseMavenDependency(info.ProjectPath, classpathFile)
+	if err != nil {
+		return nil, err
+	}
+
+	// 模块自己的编译输出放在最前面
+	classpath := make([]string, 0, len(dependencyList)+2)
+	if scope == common.ScopeTest {
+		classpath = append(classpath, fmt.Sprintf("%s/target/test-classes", modulePath))
+	}
+	classpath = append(classpath, fmt.Sprintf("%s/target/classes", modulePath))
+	return append(classpath, dependencyList...), nil
+}
+
+// runMaven 在 dir 中执行 mvn, 使用服务端配置的本地仓库
+func runMaven(projectPath, dir string, output io.Writer, phase string, args ...string) error {
+	startTime := time.Now()
+	cmdArgs := append([]string{"mvn", "-B", fmt.Sprintf("-Dmaven.repo.local=%s", common.MavenRepositoryPath)}, args...)
+	cmdResult, err := common.RunCommandOutput(common.Mvn, dir, cmdArgs, output)
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(cmdResult, "BUILD SUCCESS") {
+		return newBuildError("mvn", parseMavenFailure(projectPath, cmdResult, phase))
+	}
+	endTime := time.Now()
+	fmt.Printf("mvn exec %s time: %dms\n", phase, endTime.UnixMilli()-startTime.UnixMilli())
+	return nil
+}
+
+var (
+	// [ERROR] /path/to/Main.java:[12,5] cannot find symbol
+	mavenCompileErrorRegexp = regexp.MustCompile(`^\[ERROR\] (.+\.(?:java|kt|groovy|scala)):\[(\d+),(\d+)\] (.*)$`)
+	// [ERROR] Failed to execute goal org.apache.maven.plugins:maven-compiler-plugin:3.8.1:compile (default-compile) on project app: Compilation failure
+	mavenFailedGoalRegexp = regexp.MustCompile(`^\[ERROR\] Failed to execute goal (?:\S+?:)?(\S+?:\S+?:(\S+?))(?: \(\S+\))? on project (\S+?):`)
+	// [ERROR] Failed to execute goal on project app: Could not resolve dependencies
+	mavenFailedProjectRegexp = regexp.MustCompile(`^\[ERROR\] Failed to execute goal on project (\S+?):`)
+)
+
+// maven 插件的 goal 对应的生命周期阶段
+var mavenGoalPhase = map[string]string{
+	"resources":         "process-resources",
+	"compile":           "compile",
+	"testResources":     "process-test-resources",
+	"testCompile":       "test-compile",
+	"test":              "test",
+	"jar":               "package",
+	"war":               "package",
+	"install":           "install",
+	"list":              "dependency",
+	"build-classpath":   "dependency",
+	"resolve":           "dependency",
+	"copy-dependencies": "dependency",
+}
+
+// parseMavenFailure 从 maven 输出中解析失败的模块, 阶段和编译错误
+func parseMavenFailure(projectPath, output string, phase string) *common.BuildFailure {
+	failure := &common.BuildFailure{Phase: phase, Errors: make([]common.CompileError, 0)}
+	exist := make(map[common.CompileError]int8)
+
+	rows := strings.Split(strings.ReplaceAll(output, "\r\n", "\n"), "\n")
+	for i := 0; i < len(rows); i++ {
+		row := rows[i]
+		if match := mavenCompileErrorRegexp.FindStringSubmatch(row); match != nil {
+			line, _ := strconv.Atoi(match[2])
+			column, _ := strconv.Atoi(match[3])
+			compileError := common.CompileError{File: relativePath(projectPath, match[1]), Line: line, Column: column, Message: match[4]}
+
+			// javac 的提示信息会以不带日志级别的缩进行跟在后面
+			for i+1 < len(rows) && strings.HasPrefix(rows[i+1], "  ") {
+				i++
+				compileError.Message += "\n" + strings.TrimRight(rows[i], "\r")
+			}
+
+			// 编译错误会在失败摘要中再输出一次
+			if _, ok := exist[compileError]; !ok {
+				exist[compileError] = 1
+				failure.Errors = append(failure.Errors, compileError)
+			}
+			continue
+		}
+		if match := mavenFailedGoalRegexp.FindStringSubmatch(row); match != nil && failure.Module == "" {
+			failure.Goal = match[1]
+			failure.Module = match[3]
+			if goalPhase, ok := mavenGoalPhase[match[2]]; ok {
+				failure.Phase = goalPhase
+			}
+			continue
+		}
+		if match := mavenFailedProjectRegexp.FindStringSubmatch(row); match != nil && failure.Module == "" {
+			failure.Module = match[1]
+		}
+	}
+	return failure
+}
+
+// parseMavenDependency 读取 dependency:build-classpath 输出的依赖文件,
+// 结果写入文件而不是解析日志, 不受 maven 输出格式和语言的影响
+func parseMavenDependency(projectPath, classpathFile string) ([]string, error) {
+	data, err := os.ReadFile(classpathFile)
+	if err != nil {
+		return nil, fmt.Errorf("no find maven classpath file: %s", err.Error())
+	}
+
+	// 本地仓库中的兄弟模块替换成上传目录中的编译输出
+	reactorModules := parseReactorModules(projectPath, "")
+	repositoryPrefix := fmt.Sprintf("%s/", filepath.ToSlash(common.MavenRepositoryPath))
+
+	dependencyList := make([]string, 0)
+	for _, row := range strings.Split(strings.TrimSpace(string(data)), string(os.PathListSeparator)) {
+		if row == "" {
+			continue
+		}
+		if relPath := filepath.ToSlash(row); strings.HasPrefix(relPath, repositoryPrefix) {
+			// <groupId path>/<artifactId>/<version>/<file>
+			parts := strings.Split(relPath[len(repositoryPrefix):], "/")
+			if len(parts) >= 4 {
+				key := fmt.Sprintf("%s:%s", strings.Join(parts[:len(parts)-3], "."), parts[len(parts)-3])
+				if moduleDir, ok := reactorModules[key]; ok {
+					row = fmt.Sprintf("%s/target/classes", moduleDir)
+				}
+			}
+		}
+		dependencyList = append(dependencyList, row)
+	}
+	return dependencyList, nil
+}
+
+type mavenPom struct {
+	GroupId    string   `xml:"groupId"`
+	ArtifactId string   `xml:"artifactId"`
+	Modules    []string `xml:"modules>module"`
+	Parent     struct {
+		GroupId string `xml:"groupId"`
+	} `xml:"parent"`
+}
+
+// parseReactorModules 从根 pom 开始递归读取 modules, 返回 groupId:artifactId 到模块目录的映射
+func parseReactorModules(projectPath, modulePath string) map[string]string {
+	modules := make(map[string]string)
+	dir := projectPath
+	if modulePath != "" {
+		dir = fmt.Sprintf("%s/%s", projectPath, modulePath)
+	}
+	data, err := os.ReadFile(fmt.Sprintf("%s/pom.xml", dir))
+	if err != nil {
+		return modules
+	}
+	pom := mavenPom{}
+	if err = xml.Unmarshal(data, &pom); err != nil {
+		common.PrintError("parse pom error", err)
+		return modules
+	}
+
+	groupId := pom.GroupId
+	if groupId == "" {
+		groupId = pom.Parent.GroupId
+	}
+	modules[fmt.Sprintf("%s:%s", groupId, pom.ArtifactId)] = dir
+
+	for _, module := range pom.Modules {
+		subPath := strings.Trim(module, "/")
+		if modulePath != "" {
+			subPath = fmt.Sprintf("%s/%s", modulePath, subPath)
+		}
+		for key, subDir := range parseReactorModules(projectPath, subPath) {
+			modules[key] = subDir
+		}
+	}
+	return modules
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"reflect"
+	"remote-debug/java/common"
+	"testing"
+)
+
+func TestParseMavenFailure(t *testing.T) {
+	output := `[INFO] Scanning for projects...
+[INFO] ------------------------------------------------------------------------
+[INFO] Reactor Build Order:
+[INFO]
+[INFO] parent                                                             [pom]
+[INFO] core                                                               [jar]
+[INFO] app                                                                [jar]
+[INFO]
+[INFO] --- maven-compiler-plugin:3.8.1:compile (default-compile) @ app ---
+[INFO] Changes detected - recompiling the module!
+[INFO] Compiling 2 source files to /home/test/proj/app/target/classes
+[INFO] -------------------------------------------------------------
+[ERROR] COMPILATION ERROR :
+[INFO] -------------------------------------------------------------
+[ERROR] /home/test/proj/app/src/main/java/a/Main.java:[12,9] cannot find symbol
+  symbol:   variable foo
+  location: class a.Main
+[ERROR] /home/test/proj/app/src/main/java/a/Util.java:[3,1] class, interface, or enum expected
+[INFO] 2 errors
+[INFO] -------------------------------------------------------------
+[INFO] ------------------------------------------------------------------------
+[INFO] Reactor Summary for parent 1.0:
+[INFO]
+[INFO] parent ............................................. SUCCESS [  0.112 s]
+[INFO] core ............................................... SUCCESS [  1.020 s]
+[INFO] app ................................................ FAILURE [  0.532 s]
+[INFO] ------------------------------------------------------------------------
+[INFO] BUILD FAILURE
+[INFO] ------------------------------------------------------------------------
+[ERROR] Failed to execute goal org.apache.maven.plugins:maven-compiler-plugin:3.8.1:compile (default-compile) on project app: Compilation failure: Compilation failure:
+[ERROR] /home/test/proj/app/src/main/java/a/Main.java:[12,9] cannot find symbol
+  symbol:   variable foo
+  location: class a.Main
+[ERROR] /home/test/proj/app/src/main/java/a/Util.java:[3,1] class, interface, or enum expected
+[ERROR] -> [Help 1]
+[ERROR]
+[ERROR] After correcting the problems, you can resume the build with the command
+[ERROR]   mvn <args> -rf :app
+`
+	want := &common.BuildFailure{
+		Module: "app",
+		Phase:  "compile",
+		Goal:   "maven-compiler-plugin:3.8.1:compile",
+		Errors: []common.CompileError{
+			{File: "app/src/main/java/a/Main.java", Line: 12, Column: 9, Message: "cannot find symbol\n  symbol:   variable foo\n  location: class a.Main"},
+			{File: "app/src/main/java/a/Util.java", Line: 3, Column: 1, Message: "class, interface, or enum expected"},
+		},
+	}
+	if got := parseMavenFailure("/home/test/proj", output, "build"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("parseMavenFailure = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseMavenDependencyFailure(t *testing.T) {
+	output := "[INFO] BUILD FAILURE\r\n" +
+		"[ERROR] Failed to execute goal on project app: Could not resolve dependencies for project a:app:jar:1.0: Could not find artifact a:core:jar:1.0 -> [Help 1]\r\n"
+	got := parseMavenFailure("/home/test/proj", output, "dependency")
+	want := &common.BuildFailure{Module: "app", Phase: "dependency", Errors: []common.CompileError{}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("parseMavenFailure = %+v, want %+v", got, want)
+	}
+}
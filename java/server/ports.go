@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// tcpListen /proc/net/tcp 中处于监听状态的端口
+type tcpListen struct {
+	ip    net.IP
+	port  int
+	inode string
+}
+
+// processListenAddr 判断端口是否由进程组中的进程监听, 返回用来连接端口的地址
+func processListenAddr(pgid int, port int) (string, error) {
+	listens := make([]tcpListen, 0)
+	for _, path := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+		list, err := readTcpListen(path, port)
+		if err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+		listens = append(listens, list...)
+	}
+	if len(listens) == 0 {
+		return "", fmt.Errorf("port %d is not listening", port)
+	}
+
+	inodes, err := processGroupSockets(pgid)
+	if err != nil {
+		return "", err
+	}
+	for _, listen := range listens {
+		if !inodes[listen.inode] {
+			continue
+		}
+		// 监听所有网卡时通过本机地址连接
+		ip := listen.ip
+		if ip.IsUnspecified() {
+			ip = net.IPv4(127, 0, 0, 1)
+			if listen.ip.To4() == nil {
+				ip = net.IPv6loopback
+			}
+		}
+		return net.JoinHostPort(ip.String(), strconv.Itoa(port)), nil
+	}
+	return "", fmt.Errorf("port %d is not owned by the project", port)
+}
+
+// readTcpListen 读取 /proc/net/tcp 或 /proc/net/tcp6 中监听指定端口的记录
+func readTcpListen(path string, port int) ([]tcpListen, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = file.Close() }()
+
+	listens := make([]tcpListen, 0)
+	scanner := bufio.NewScanner(file)
+	// 第一行是表头
+	scanner.Scan()
+	for scanner.Scan() {
+		// sl local_address rem_address st tx_queue:rx_queue tr:tm->when retrnsmt uid timeout inode
+		fields := strings.Fields(scanner.Text())
+		// 0A 是 LISTEN
+		if len(fields) < 10 || fields[3] != "0A" {
+			continue
+		}
+		ipHex, portHex, found := strings.Cut(fields[1], ":")
+		if !found {
+			continue
+		}
+		localPort, err := strconv.ParseUint(portHex, 16, 16)
+		if err != nil || int(localPort) != port {
+			continue
+		}
+		ip, err := parseProcIP(ipHex)
+		if err != nil {
+			continue
+		}
+		listens = append(listens, tcpListen{ip: ip, port: port, inode: fields[9]})
+	}
+	return listens, scanner.Err()
+}
+
+// parseProcIP /proc/net/tcp 中的地址按照 32 位一组以主机字节序 (小端) 保存
+func parseProcIP(s string) (net.IP, error) {
+	data, err := hex.DecodeString(s)
+	if err != nil || (len(data) != net.IPv4len && len(data) != net.IPv6len) {
+		return nil, fmt.Errorf("ip error: %s", s)
+	}
+	for i := 0; i < len(data); i += 4 {
+		data[i], data[i+1], data[i+2], data[i+3] = data[i+3], data[i+2], data[i+1], data[i]
+	}
+	return net.IP(data), nil
+}
+
+// processGroupSockets 进程组中所有进程打开的 socket inode
+func processGroupSockets(pgid int) (map[string]bool, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+	inodes := make(map[string]bool)
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		// 字段 5 是进程组 id
+		fields, err := readProcStat(pid)
+		if err != nil || fields[2] != strconv.Itoa(pgid) {
+			continue
+		}
+		fds, err := os.ReadDir(fmt.Sprintf("/proc/%d/fd", pid))
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			link, err := os.Readlink(fmt.Sprintf("/proc/%d/fd/%s", pid, fd.Name()))
+			if err != nil {
+				continue
+			}
+			// socket:[12345]
+			if strings.HasPrefix(link, "socket:[") {
+				inodes[strings.TrimSuffix(strings.TrimPrefix(link, "socket:["), "]")] = true
+			}
+		}
+	}
+	return inodes, nil
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"remote-debug/java/common"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// projectKey 进程表的 key, 不同用户的同名项目互不影响
+type projectKey struct {
+	user    string
+	project string
+}
+
+func (k projectKey) String() string {
+	return fmt.Sprintf("%s/%s", k.user, k.project)
+}
+
+type process struct {
+	key projectKey
+
+	// 重启时使用相同的启动参数
+	args        []string
+	env         environment
+	dir         string
+	policy      restartPolicy
+	stopOptions stopOptions
+	// JDWP 端口, 0 代表没有开启调试
+	debugPort int
+
+	// 第一次启动的日志在日志文件中的开始位置
+	logOffset int64
+
+	// mutex 保护下面的运行状态
+	mutex     sync.Mutex
+	cmd       *exec.Cmd
+	startTime time.Time
+	// 进程启动时间, 保存到状态文件用来判断 pid 是否被复用
+	startToken uint64
+	// 服务端重启后接管的进程, 不是当前进程的子进程
+	adopted  bool
+	state    string
+	restarts int
+	// 连续快速退出的次数, 用来计算退避时间和判断是否崩溃循环
+	failures int
+	lastExit *common.ExitInfo
+	stopping bool
+
+	// stop 关闭后不再重启, 监控结束后关闭 done
+	stop chan struct{}
+	done chan struct{}
+}
+
+var (
+	// processMutex 保护 processMap 和 projectLocks
+	processMutex sync.Mutex
+	processMap   = make(map[projectKey]*process)
+
+	// 同一个项目的部署, 停止和重启需要串行执行
+	projectLocks = make(map[projectKey]*sync.Mutex)
+)
+
+// lockProject 获取项目锁, 返回解锁函数
+func lockProject(key projectKey) func() {
+	processMutex.Lock()
+	lock, exist := projectLocks[key]
+	if !exist {
+		lock = &sync.Mutex{}
+		projectLocks[key] = lock
+	}
+	processMutex.Unlock()
+
+	lock.Lock()
+	return lock.Unlock
+}
+
+func getProcess(key projectKey) (*process, bool) {
+	processMutex.Lock()
+	defer processMutex.Unlock()
+	p, exist := processMap[key]
+	return p, exist
+}
+
+func listProcess() []*process {
+	processMutex.Lock()
+	defer processMutex.Unlock()
+	processes := make([]*process, 0, len(processMap))
+	for _, p := range processMap {
+		processes = append(processes, p)
+	}
+	return processes
+}
+
+func (p *process) exited() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// runProject 启动项目并登记到 processMap, 在后台监控进程并按照重启策略重启
+func runProject(key projectKey, dir string, args []string, env environment, policy restartPolicy, stopOptions stopOptions, debugPort int) (*process, error) {
+	p := &process{
+		key:         key,
+		debugPort:   debugPort,
+		args:        args,
+		env:         env,
+		dir:         dir,
+		policy:      policy,
+		stopOptions: stopOptions,
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	logFile, err := p.start()
+	if err != nil {
+		return nil, err
+	}
+	p.logOffset, _ = logFile.Seek(0, io.SeekCurrent)
+
+	processMutex.Lock()
+	processMap[key] = p
+	bindDebugPort(p)
+	processMutex.Unlock()
+
+	go p.supervise(logFile)
+	saveState()
+	return p, nil
+}
+
+// start 启动进程, 日志追加到项目的日志文件
+func (p *process) start() (*os.File, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.stopping {
+		return nil, fmt.Errorf("project is stopping: %s", p.key)
+	}
+
+	// 创建日志文件
+	logFile, err := createLogFile(p.key)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = logFile.Seek(0, io.SeekEnd); err != nil {
+		_ = logFile.Close()
+		return nil, err
+	}
+
+	cmd := &exec.Cmd{
+		Path:   p.args[0],
+		Args:   p.args,
+		Env:    p.env.environ(),
+		Dir:    p.dir,
+		Stdout: logFile,
+		Stderr: logFile,
+		// 单独的进程组, 停止时连同 fork 出来的子进程一起杀掉
+		SysProcAttr: &syscall.SysProcAttr{Setpgid: true},
+	}
+	fmt.Println(cmd.Args)
+	if err = cmd.Start(); err != nil {
+		_ = logFile.Close()
+		common.PrintError("start process error", err)
+		// 返回错误
+		return nil, err
+	}
+
+	p.cmd = cmd
+	p.startTime = time.Now()
+	p.startToken, _ = processStartToken(cmd.Process.Pid)
+	p.adopted = false
+	p.state = common.StateRunning
+	return logFile, nil
+}
+
+func (p *process) pid() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.cmd.Process.Pid
+}
+
+// attachProcess 持续发送本次启动的日志, 直到客户端断开或者进程退出
+func attachProcess(conn net.Conn, p *process) {
+	options := logOptions{offset: p.logOffset, tail: -1, follow: true, stopFollow: p.exited}
+	if err := streamLog(conn, logPath(p.key), options); err != nil {
+		common.PrintError("attach process error", err)
+	}
+}
+
+func processStatus(p *process) common.ProcessStatus {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	status := common.ProcessStatus{
+		User:          p.key.user,
+		Project:       p.key.project,
+		Pid:           p.cmd.Process.Pid,
+		Alive:         p.state == common.StateRunning,
+		State:         p.state,
+		StartTime:     p.startTime.UnixMilli(),
+		DebugPort:     p.debugPort,
+		RestartPolicy: p.policy.mode,
+		Restarts:      p.restarts,
+		CrashLoop:     p.failures >= crashLoopFailures,
+		LastExit:      p.lastExit,
+	}
+	if !status.Alive && p.lastExit != nil {
+		status.Uptime = p.lastExit.Time - status.StartTime
+	} else {
+		status.Uptime = time.Since(p.startTime).Milliseconds()
+	}
+	return status
+}
+
+// projectDir 项目目录, 和日志, gradle 初始化脚本分开存放, 用户名不会和这些目录冲突
+func projectDir(key projectKey) string {
+	return fmt.Sprintf("%s/remote-debug/projects/%s/%s", common.HomePath, key.user, key.project)
+}
+
+func logPath(key projectKey) string {
+	return fmt.Sprintf("%s/remote-debug/logs/%s/%s.log", common.HomePath, key.user, key.project)
+}
+
+func createLogFile(key projectKey) (*os.File, error) {
+	_ = os.MkdirAll(fmt.Sprintf("%s/remote-debug/logs/%s", common.HomePath, key.user), 0777)
+	logFile, err := os.OpenFile(logPath(key), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		common.PrintError("open log path error error", err)
+		return nil, err
+	}
+	return logFile, nil
+}
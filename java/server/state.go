@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	goio "io"
+	"os"
+	"os/exec"
+	"remote-debug/common/io"
+	"remote-debug/java/common"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// processState 保存到状态文件的进程信息, 服务端重启后用来重新接管还在运行的进程
+type processState struct {
+	User    string `json:"User"`
+	Project string `json:"Project"`
+	Pid     int    `json:"Pid"`
+	// /proc/<pid>/stat 第 22 个字段, 进程启动时间, 用来判断 pid 是否被其他进程复用
+	StartToken uint64 `json:"StartToken"`
+	StartTime  int64  `json:"StartTime"`
+
+	Args          []string `json:"Args"`
+	Env           []string `json:"Env"`
+	CleanEnv      bool     `json:"CleanEnv"`
+	EnvAllowlist  []string `json:"EnvAllowlist"`
+	Dir           string   `json:"Dir"`
+	RestartPolicy string   `json:"RestartPolicy"`
+	MaxRetries    int      `json:"MaxRetries"`
+	Restarts      int      `json:"Restarts"`
+	StopTimeout   int64    `json:"StopTimeout"`
+	PreStop       string   `json:"PreStop"`
+	LogOffset     int64    `json:"LogOffset"`
+	DebugPort     int      `json:"DebugPort"`
+}
+
+type registryState struct {
+	Processes []processState `json:"Processes"`
+}
+
+var (
+	// stateMutex 保证状态文件按顺序写入
+	stateMutex sync.Mutex
+)
+
+func statePath() string {
+	return fmt.Sprintf("%s/remote-debug/state.json", common.HomePath)
+}
+
+// saveState 把正在运行的进程写入状态文件, 进程启动, 重启和退出后调用, 调用方不能持有 processMutex 和进程锁
+func saveState() {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+
+	state := registryState{Processes: make([]processState, 0)}
+	for _, p := range listProcess() {
+		p.mutex.Lock()
+		if p.state == common.StateRunning {
+			state.Processes = append(state.Processes, processState{
+				User:          p.key.user,
+				Project:       p.key.project,
+				Pid:           p.cmd.Process.Pid,
+				StartToken:    p.startToken,
+				StartTime:     p.startTime.UnixMilli(),
+				Args:          p.args,
+				Env:           p.env.vars,
+				CleanEnv:      p.env.clean,
+				EnvAllowlist:  p.env.allowlist,
+				Dir:           p.dir,
+				RestartPolicy: p.policy.mode,
+				MaxRetries:    p.policy.maxRetries,
+				Restarts:      p.restarts,
+				StopTimeout:   int64(p.stopOptions.timeout),
+				PreStop:       p.stopOptions.preStop,
+				LogOffset:     p.logOffset,
+				DebugPort:     p.debugPort,
+			})
+		}
+		p.mutex.Unlock()
+	}
+
+	data, err := io.ToByte(&state)
+	if err != nil {
+		common.PrintError("marshal state error", err)
+		return
+	}
+	// 先写临时文件再改名, 避免服务端中途退出留下不完整的状态文件
+	_ = os.MkdirAll(fmt.Sprintf("%s/remote-debug", common.HomePath), 0777)
+	tmpPath := statePath() + ".tmp"
+	if err = os.WriteFile(tmpPath, data, 0600); err != nil {
+		common.PrintError("write state error", err)
+		return
+	}
+	if err = os.Rename(tmpPath, statePath()); err != nil {
+		common.PrintError("rename state error", err)
+	}
+}
+
+// restoreState 读取状态文件, 重新接管还在运行的进程, 已经退出或者 pid 被复用的记录直接丢弃
+func restoreState() {
+	data, err := os.ReadFile(statePath())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			common.PrintError("read state error", err)
+		}
+		return
+	}
+	state := registryState{}
+	if err = io.ToObj(data, &state); err != nil {
+		common.PrintError("parse state error", err)
+		return
+	}
+
+	for _, ps := range state.Processes {
+		key := projectKey{user: ps.User, project: ps.Project}
+		if ps.StartToken == 0 || len(ps.Args) == 0 {
+			fmt.Println("drop process", key, ps.Pid, "without start token")
+			continue
+		}
+		if token, err := processStartToken(ps.Pid); err != nil || token != ps.StartToken {
+			fmt.Println("drop exited process", key, ps.Pid)
+			continue
+		}
+		if err = adoptProcess(key, ps); err != nil {
+			common.PrintError(fmt.Sprintf("adopt process %s %d error", key, ps.Pid), err)
+			continue
+		}
+		fmt.Println("adopt process", key, ps.Pid)
+	}
+	saveState()
+}
+
+// adoptProcess 接管上一次服务端启动的进程, 它不是当前进程的子进程, 只能轮询判断是否退出
+func adoptProcess(key projectKey, ps processState) error {
+	policy, err := newRestartPolicy(ps.RestartPolicy, ps.MaxRetries)
+	if err != nil {
+		return err
+	}
+	proc, err := os.FindProcess(ps.Pid)
+	if err != nil {
+		return err
+	}
+	logFile, err := createLogFile(key)
+	if err != nil {
+		return err
+	}
+	if _, err = logFile.Seek(0, goio.SeekEnd); err != nil {
+		_ = logFile.Close()
+		return err
+	}
+
+	p := &process{
+		key:         key,
+		args:        ps.Args,
+		env:         environment{vars: ps.Env, clean: ps.CleanEnv, allowlist: ps.EnvAllowlist},
+		dir:         ps.Dir,
+		policy:      policy,
+		stopOptions: stopOptions{timeout: time.Duration(ps.StopTimeout), preStop: ps.PreStop},
+		logOffset:   ps.LogOffset,
+		debugPort:   ps.DebugPort,
+		cmd:         &exec.Cmd{Path: ps.Args[0], Args: ps.Args, Dir: ps.Dir, Process: proc},
+		startTime:   time.UnixMilli(ps.StartTime),
+		startToken:  ps.StartToken,
+		adopted:     true,
+		state:       common.StateRunning,
+		restarts:    ps.Restarts,
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	if p.stopOptions.timeout <= 0 {
+		p.stopOptions.timeout = stopTimeout
+	}
+
+	processMutex.Lock()
+	processMap[key] = p
+	bindDebugPort(p)
+	processMutex.Unlock()
+
+	go p.supervise(logFile)
+	return nil
+}
+
+// waitAdopted 每 500ms 检查一次接管的进程是否还在, 拿不到退出码
+func waitAdopted(pid int, token uint64) *common.ExitInfo {
+	for {
+		if current, err := processStartToken(pid); err != nil || current != token {
+			return &common.ExitInfo{Code: -1, Time: time.Now().UnixMilli()}
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+// processStartToken 读取 /proc/<pid>/stat 中的进程启动时间
+func processStartToken(pid int) (uint64, error) {
+	fields, err := readProcStat(pid)
+	if err != nil {
+		return 0, err
+	}
+	// 僵尸进程已经退出, 只是还没有被回收
+	if fields[0] == "Z" {
+		return 0, fmt.Errorf("process %d is zombie", pid)
+	}
+	return strconv.ParseUint(fields[19], 10, 64)
+}
+
+// readProcStat 读取 /proc/<pid>/stat, 返回进程名后面的字段, 第一个是字段 3 (进程状态)
+func readProcStat(pid int) ([]string, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return nil, err
+	}
+	// 进程名可能包含空格和括号, 从最后一个 ) 后面开始按空格分割
+	stat := string(data)
+	index := strings.LastIndexByte(stat, ')')
+	if index < 0 {
+		return nil, fmt.Errorf("parse /proc/%d/stat error", pid)
+	}
+	fields := strings.Fields(stat[index+1:])
+	if len(fields) < 20 {
+		return nil, fmt.Errorf("parse /proc/%d/stat error", pid)
+	}
+	return fields, nil
+}
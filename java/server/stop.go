@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"remote-debug/java/common"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+var (
+	// 停止进程时默认的等待时间, 部署时可以单独指定
+	stopTimeout = 10 * time.Second
+)
+
+type stopOptions struct {
+	// 发送 SIGTERM 后等待退出的时间, 超时后发送 SIGKILL
+	timeout time.Duration
+	// 发送 SIGTERM 前执行的命令, 为空则不执行
+	preStop string
+}
+
+func newStopOptions(info *common.ProjectInfo) (stopOptions, error) {
+	if info.StopTimeout < 0 {
+		return stopOptions{}, fmt.Errorf("stop timeout error: %d", info.StopTimeout)
+	}
+	options := stopOptions{timeout: stopTimeout, preStop: info.PreStop}
+	if info.StopTimeout > 0 {
+		options.timeout = time.Duration(info.StopTimeout) * time.Second
+	}
+	return options, nil
+}
+
+// stopProject 停止正在运行的项目并且不再重启, 项目不存在或者已经退出则返回 nil, 调用方需要持有项目锁
+func stopProject(key projectKey) *common.StopInfo {
+	p, exist := getProcess(key)
+	if !exist || p.exited() {
+		return nil
+	}
+
+	p.mutex.Lock()
+	if !p.stopping {
+		p.stopping = true
+		close(p.stop)
+	}
+	running := p.state == common.StateRunning
+	pid := p.cmd.Process.Pid
+	p.mutex.Unlock()
+
+	info := &common.StopInfo{}
+	if running {
+		info.Pid = pid
+		p.terminate(info)
+	}
+	<-p.done
+
+	if running {
+		p.mutex.Lock()
+		info.Exit = p.lastExit
+		p.mutex.Unlock()
+	}
+	return info
+}
+
+// terminate 执行 preStop 后向进程组发送 SIGTERM, 超时后发送 SIGKILL, 返回时主进程已经退出
+func (p *process) terminate(info *common.StopInfo) {
+	if p.stopOptions.preStop != "" {
+		if err := p.runPreStop(info.Pid); err != nil {
+			common.PrintError(fmt.Sprintf("%s pre stop error", p.key), err)
+			info.PreStopError = err.Error()
+		}
+	}
+
+	fmt.Println("stop old project", info.Pid)
+	killGroup(info.Pid, syscall.SIGTERM)
+	select {
+	case <-p.done:
+	case <-time.After(p.stopOptions.timeout):
+		fmt.Println(p.key, info.Pid, "not exit after", p.stopOptions.timeout, "kill it")
+		killGroup(info.Pid, syscall.SIGKILL)
+		info.Killed = true
+		<-p.done
+	}
+
+	// 主进程退出后杀掉还留在进程组里的子进程
+	killGroup(info.Pid, syscall.SIGKILL)
+}
+
+// runPreStop 在项目目录执行 preStop 命令, 输出写入项目日志, 最多执行 stopOptions.timeout
+func (p *process) runPreStop(pid int) error {
+	logFile, err := createLogFile(p.key)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = logFile.Close() }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.stopOptions.timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sh", "-c", p.stopOptions.preStop)
+	cmd.Dir = p.dir
+	cmd.Env = append(os.Environ(), "REMOTE_DEBUG_PID="+strconv.Itoa(pid))
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	fmt.Println(p.key, "pre stop", p.stopOptions.preStop)
+	if err = cmd.Run(); ctx.Err() != nil {
+		return fmt.Errorf("pre stop timeout after %s", p.stopOptions.timeout)
+	}
+	return err
+}
+
+// killGroup 向整个进程组发送信号, 进程启动时设置了 Setpgid, 进程组 id 就是主进程的 pid
+func killGroup(pid int, signal syscall.Signal) {
+	if err := syscall.Kill(-pid, signal); err != nil && err != syscall.ESRCH {
+		common.PrintError(fmt.Sprintf("kill process group %d error", pid), err)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"remote-debug/java/common"
+	"syscall"
+	"time"
+)
+
+const (
+	// 运行时间超过 stableTime 才算启动成功, 否则算作一次快速失败
+	stableTime = 30 * time.Second
+	// 连续快速失败达到这个次数认为进入崩溃循环
+	crashLoopFailures = 3
+
+	minBackoff = time.Second
+	maxBackoff = time.Minute
+)
+
+type restartPolicy struct {
+	mode string
+	// on-failure 最多重启次数, 0 代表不限制
+	maxRetries int
+}
+
+func newRestartPolicy(mode string, maxRetries int) (restartPolicy, error) {
+	switch mode {
+	case "":
+		mode = common.RestartNever
+	case common.RestartNever, common.RestartOnFailure, common.RestartAlways:
+	default:
+		return restartPolicy{}, fmt.Errorf("unknown restart policy: %s", mode)
+	}
+	if maxRetries < 0 {
+		return restartPolicy{}, fmt.Errorf("max retries error: %d", maxRetries)
+	}
+	return restartPolicy{mode: mode, maxRetries: maxRetries}, nil
+}
+
+// shouldRestart 根据退出信息和已经重启的次数判断是否需要重启
+func (policy restartPolicy) shouldRestart(exit *common.ExitInfo, restarts int) bool {
+	switch policy.mode {
+	case common.RestartAlways:
+		return true
+	case common.RestartOnFailure:
+		return exit.Code != 0 && (policy.maxRetries == 0 || restarts < policy.maxRetries)
+	default:
+		return false
+	}
+}
+
+// backoff 连续快速失败时重启的等待时间指数增长
+func backoff(failures int) time.Duration {
+	delay := minBackoff
+	for i := 1; i < failures && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxBackoff {
+		delay = maxBackoff
+	}
+	return delay
+}
+
+// supervise 等待进程退出, 记录退出信息并按照重启策略重启, 不再重启时关闭 done
+func (p *process) supervise(logFile *os.File) {
+	defer close(p.done)
+	// 进程不再运行, 从状态文件中删除
+	defer saveState()
+	for {
+		p.mutex.Lock()
+		cmd, adopted, token := p.cmd, p.adopted, p.startToken
+		p.mutex.Unlock()
+
+		var exit *common.ExitInfo
+		if adopted {
+			exit = waitAdopted(cmd.Process.Pid, token)
+		} else {
+			exit = exitInfo(cmd.Process.Wait())
+		}
+		fmt.Println(p.key, cmd.Process.Pid, "exit:", exit.Describe())
+		_, _ = fmt.Fprintf(logFile, "\n[remote-debug] %s pid %d %s\n",
+			time.UnixMilli(exit.Time).Format("2006-01-02 15:04:05"), cmd.Process.Pid, exit.Describe())
+		_ = logFile.Close()
+
+		p.mutex.Lock()
+		p.lastExit = exit
+		if time.UnixMilli(exit.Time).Sub(p.startTime) < stableTime {
+			p.failures++
+		} else {
+			p.failures = 0
+		}
+		if p.stopping {
+			p.state = common.StateStopped
+			p.mutex.Unlock()
+			return
+		}
+		if !p.policy.shouldRestart(exit, p.restarts) {
+			p.state = common.StateExited
+			if p.policy.mode == common.RestartOnFailure && exit.Code != 0 {
+				p.state = common.StateFailed
+			}
+			p.mutex.Unlock()
+			return
+		}
+		delay := backoff(p.failures)
+		p.state = common.StateBackoff
+		p.mutex.Unlock()
+
+		// 等待重启, 期间停止项目则直接结束
+		fmt.Println(p.key, "restart after", delay)
+		select {
+		case <-p.stop:
+			p.mutex.Lock()
+			p.state = common.StateStopped
+			p.mutex.Unlock()
+			return
+		case <-time.After(delay):
+		}
+
+		var err error
+		if logFile, err = p.start(); err != nil {
+			p.mutex.Lock()
+			p.state = common.StateFailed
+			if p.stopping {
+				p.state = common.StateStopped
+			}
+			p.mutex.Unlock()
+			return
+		}
+		p.mutex.Lock()
+		p.restarts++
+		p.mutex.Unlock()
+		saveState()
+	}
+}
+
+func exitInfo(state *os.ProcessState, err error) *common.ExitInfo {
+	exit := &common.ExitInfo{Code: -1, Time: time.Now().UnixMilli()}
+	if err != nil || state == nil {
+		exit.Error = fmt.Sprintf("%v", err)
+		return exit
+	}
+	exit.Code = state.ExitCode()
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		exit.Signal = status.Signal().String()
+	}
+	return exit
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"remote-debug/common/io"
+	"remote-debug/java/common"
+	"time"
+)
+
+// handleTunnel 返回结果后连接上只有复用的流, 客户端每个本地连接打开一个流, 分别转发到项目的端口
+func handleTunnel(conn net.Conn, key projectKey) {
+	if _, exist := getProcess(key); !exist {
+		_ = io.SendMessage(conn, common.Result{Code: 404, Msg: fmt.Sprintf("no find project: %s", key)})
+		return
+	}
+	if err := io.SendMessage(conn, common.Result{Code: 200}); err != nil {
+		return
+	}
+
+	fmt.Println("tunnel", key, conn.RemoteAddr())
+	mux := io.NewMux(conn)
+	for {
+		stream, err := mux.Accept()
+		if err != nil {
+			break
+		}
+		go tunnelStream(stream, key)
+	}
+	fmt.Println("tunnel closed", key, conn.RemoteAddr())
+}
+
+// tunnelStream 流上的第一条消息是转发的端口, 进程重启后端口可能变化, 每个流单独检查
+func tunnelStream(conn net.Conn, key projectKey) {
+	defer func() { _ = conn.Close() }()
+	request := common.Request{}
+	if err := io.ReadMessageLimit(conn, &request, 4<<10); err != nil {
+		common.PrintError("read tunnel request error", err)
+		return
+	}
+
+	p, exist := getProcess(key)
+	if !exist {
+		_ = io.SendMessage(conn, common.Result{Code: 404, Msg: fmt.Sprintf("no find project: %s", key)})
+		return
+	}
+
+	var addr string
+	if request.Port == 0 || request.Port == p.debugPort {
+		if p.debugPort == 0 {
+			_ = io.SendMessage(conn, common.Result{Code: 400, Msg: fmt.Sprintf("project is not started with -debug: %s", key)})
+			return
+		}
+		addr = debugDialAddr(p.debugPort)
+	} else {
+		// 只允许转发服务端启动的进程监听的端口, 不能用来访问服务器上的其他服务
+		status := processStatus(p)
+		if !status.Alive {
+			_ = io.SendMessage(conn, common.Result{Code: 409, Msg: fmt.Sprintf("project is not running: %s", key)})
+			return
+		}
+		var err error
+		if addr, err = processListenAddr(status.Pid, request.Port); err != nil {
+			_ = io.SendMessage(conn, common.Result{Code: 403, Msg: err.Error()})
+			return
+		}
+	}
+
+	target, err := net.DialTimeout("tcp", addr, 5*time.Second)
+	if err != nil {
+		_ = io.SendMessage(conn, common.Result{Code: 502, Msg: fmt.Sprintf("connect %s error: %v", addr, err)})
+		return
+	}
+	if err = io.SendMessage(conn, common.Result{Code: 200, DebugPort: p.debugPort}); err != nil {
+		_ = target.Close()
+		return
+	}
+
+	fmt.Println("tunnel stream", key, conn.RemoteAddr(), "->", target.RemoteAddr())
+	common.Pipe(conn, target)
+}
+
+// debugDialAddr tunnel 和热替换在服务器本机连接 JDWP, JDWP 默认只监听本机, 端口不需要对外开放,
+// 监听所有网卡时同样通过本机地址连接
+func debugDialAddr(port int) string {
+	host := debugHost
+	if host == "" || host == "*" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+	return net.JoinHostPort(host, fmt.Sprintf("%d", port))
+}